@@ -0,0 +1,247 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultThresholds are the alert thresholds of budgets that set none.
+var DefaultThresholds = []float64{90, 100}
+
+// Alert is a budget passing one of its thresholds within one period.
+type Alert struct {
+	ID        int
+	Category  string
+	Window    DateRange
+	Threshold float64
+	Spent     float64
+	Limit     float64
+	SentAt    string
+}
+
+func (a Alert) Title() string {
+	if a.Threshold >= 100 {
+		return fmt.Sprintf("Budget exceeded: %s", a.Category)
+	}
+	return fmt.Sprintf("Budget at %g%%: %s", a.Threshold, a.Category)
+}
+
+func (a Alert) Message() string {
+	return fmt.Sprintf("%s has spent $%.2f of $%.2f (%.1f%%) in %s - %s",
+		a.Category, a.Spent, a.Limit, a.Spent/a.Limit*100, a.Window.Start, a.Window.End)
+}
+
+// ParseThresholds reads a comma-separated list of percentages such as
+// "50,90,100".
+func ParseThresholds(s string) ([]float64, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var thresholds []float64
+	for _, part := range strings.Split(s, ",") {
+		t, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || t <= 0 {
+			return nil, invalidf("invalid alert threshold %q, use positive percentages such as 50,90,100", part)
+		}
+		thresholds = append(thresholds, t)
+	}
+	slices.Sort(thresholds)
+	return slices.Compact(thresholds), nil
+}
+
+func FormatThresholds(thresholds []float64) string {
+	parts := make([]string, len(thresholds))
+	for i, t := range thresholds {
+		parts[i] = strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// CheckAlerts evaluates the budget for category over the period containing
+// date and notifies about thresholds it has passed. Every threshold fires
+// at most once per period: RecordAlert claims it before anyone is
+// notified, so concurrent processes do not send it twice, and a failed
+// notification is not retried. When one change passes several thresholds
+// only the highest is sent. It returns the alerts that were sent; a
+// category without an active budget has none.
+func CheckAlerts(ctx context.Context, s Store, category string, date time.Time, notifiers []Notifier) ([]Alert, error) {
+	st, err := CheckBudget(ctx, s, category, date)
+	if errors.Is(err, ErrNotFound) || (err == nil && !st.Active) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	thresholds := slices.Sorted(slices.Values(st.Budget.Thresholds))
+	if len(thresholds) == 0 {
+		thresholds = DefaultThresholds
+	}
+	var crossed *Alert
+	for _, t := range thresholds {
+		if st.Ratio()*100 < t {
+			continue
+		}
+		a := Alert{Category: category, Window: st.Window, Threshold: t, Spent: st.Spent, Limit: st.Limit}
+		claimed, err := s.RecordAlert(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			crossed = &a
+		}
+	}
+	if crossed == nil {
+		return nil, nil
+	}
+	return []Alert{*crossed}, Notify(ctx, notifiers, *crossed)
+}
+
+// Notify sends a to every notifier and returns their errors joined.
+func Notify(ctx context.Context, notifiers []Notifier, a Alert) error {
+	var errs []error
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func createAlertTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS alerts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        category TEXT NOT NULL,
+        period_start TEXT NOT NULL,
+        period_end TEXT NOT NULL,
+        threshold REAL NOT NULL,
+        spent REAL NOT NULL,
+        budget_limit REAL NOT NULL,
+        sent_at TEXT NOT NULL,
+        UNIQUE (category, period_start, threshold)
+    );
+    CREATE TABLE IF NOT EXISTS notifiers (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        kind TEXT NOT NULL,
+        target TEXT,
+        server TEXT
+    );`)
+	return err
+}
+
+func (s *SQLiteStore) RecordAlert(ctx context.Context, a Alert) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx, `
+        INSERT OR IGNORE INTO alerts (category, period_start, period_end, threshold, spent, budget_limit, sent_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		a.Category, a.Window.Start, a.Window.End, a.Threshold, a.Spent, a.Limit, time.Now().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return n > 0, s.commit(ctx, tx)
+}
+
+func (s *SQLiteStore) GetAlerts(ctx context.Context, limit int) ([]Alert, error) {
+	return getAlerts(ctx, s.db, limit)
+}
+
+func getAlerts(ctx context.Context, q querier, limit int) ([]Alert, error) {
+	query := "SELECT id, category, period_start, period_end, threshold, spent, budget_limit, sent_at FROM alerts ORDER BY id DESC"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []Alert
+	for rows.Next() {
+		var a Alert
+		if err = rows.Scan(&a.ID, &a.Category, &a.Window.Start, &a.Window.End, &a.Threshold, &a.Spent, &a.Limit, &a.SentAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+func (s *SQLiteStore) AddNotifier(ctx context.Context, c NotifierConfig) (int, error) {
+	if _, err := NewNotifier(c); err != nil {
+		return 0, err
+	}
+
+	err := s.withJournal(ctx, func(j *journal) error {
+		res, err := j.tx.ExecContext(ctx, "INSERT INTO notifiers (kind, target, server) VALUES (?, ?, ?)", c.Kind, c.Target, c.Server)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		c.ID = int(id)
+		return j.record("create", "notifiers", c.ID, nil, &c)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return c.ID, nil
+}
+
+func (s *SQLiteStore) GetNotifiers(ctx context.Context) ([]NotifierConfig, error) {
+	return getNotifiers(ctx, s.db)
+}
+
+func getNotifiers(ctx context.Context, q querier) ([]NotifierConfig, error) {
+	rows, err := q.QueryContext(ctx, "SELECT id, kind, COALESCE(target, ''), COALESCE(server, '') FROM notifiers ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs []NotifierConfig
+	for rows.Next() {
+		var c NotifierConfig
+		if err = rows.Scan(&c.ID, &c.Kind, &c.Target, &c.Server); err != nil {
+			return nil, err
+		}
+		configs = append(configs, c)
+	}
+	return configs, rows.Err()
+}
+
+func (s *SQLiteStore) RemoveNotifier(ctx context.Context, id int) error {
+	return s.withJournal(ctx, func(j *journal) error {
+		var c NotifierConfig
+		err := j.tx.QueryRowContext(ctx, "SELECT id, kind, COALESCE(target, ''), COALESCE(server, '') FROM notifiers WHERE id = ?", id).
+			Scan(&c.ID, &c.Kind, &c.Target, &c.Server)
+		if errors.Is(err, sql.ErrNoRows) {
+			return notFoundf("notifier #%d not found", id)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = j.tx.ExecContext(ctx, "DELETE FROM notifiers WHERE id = ?", id); err != nil {
+			return err
+		}
+		return j.record("delete", "notifiers", id, &c, nil)
+	})
+}
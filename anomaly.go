@@ -0,0 +1,279 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	AnomalyOutlier   = "outlier"
+	AnomalyDuplicate = "duplicate"
+	AnomalyRecurring = "new recurring"
+)
+
+// Anomaly is an expense that looks unusual, with the reason in words.
+type Anomaly struct {
+	Transaction Transaction
+	Kind        string
+	Reason      string
+}
+
+// AnomalyOptions says which expenses FindAnomalies checks and what it
+// compares them against.
+type AnomalyOptions struct {
+	// Window holds the expenses to check.
+	Window DateRange
+	// History is how many days before the window the typical amounts are
+	// learnt from.
+	History int
+	// Sensitivity is how many robust standard deviations above the median
+	// an amount has to be to count as an outlier; 3.5 when zero.
+	Sensitivity float64
+}
+
+const (
+	defaultSensitivity = 3.5
+	// The fewest earlier expenses a category or payee needs before its
+	// amounts are considered known.
+	minCategorySamples = 5
+	minPayeeSamples    = 3
+)
+
+// payee is who an expense was paid to as far as the tracker knows: its
+// description, ignoring case and surrounding spaces.
+func payee(t Transaction) string {
+	return strings.ToLower(strings.TrimSpace(t.Description))
+}
+
+// amountModel is the typical amount of a group of expenses: their median
+// and a robust spread, the scaled median absolute deviation. Groups that
+// always cost the same get 10% of the median instead, so that a doubled
+// subscription still stands out.
+type amountModel struct {
+	count  int
+	median float64
+	spread float64
+}
+
+func newAmountModel(amounts []float64) amountModel {
+	m := amountModel{count: len(amounts), median: median(amounts)}
+	deviations := make([]float64, len(amounts))
+	for i, a := range amounts {
+		deviations[i] = math.Abs(a - m.median)
+	}
+	m.spread = math.Max(1.4826*median(deviations), 0.1*m.median)
+	return m
+}
+
+func (m amountModel) score(amount float64) float64 {
+	if m.spread == 0 {
+		return 0
+	}
+	return (amount - m.median) / m.spread
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Sorted(slices.Values(values))
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// FindAnomalies checks the expenses in the window for three things:
+// amounts far above what their payee or category usually costs, the same
+// charge twice within a few days, and recurring payments that first
+// became regular within the window. Results are oldest first.
+func FindAnomalies(ctx context.Context, s Store, opts AnomalyOptions) ([]Anomaly, error) {
+	if opts.Window.Start == "" || opts.Window.End == "" {
+		return nil, invalidf("window needs a start and an end date")
+	}
+	if opts.History <= 0 {
+		return nil, invalidf("history must be a positive number of days")
+	}
+	if opts.Sensitivity < 0 {
+		return nil, invalidf("sensitivity cannot be negative")
+	}
+	if opts.Sensitivity == 0 {
+		opts.Sensitivity = defaultSensitivity
+	}
+	start, err := time.Parse(dateLayout, opts.Window.Start)
+	if err != nil {
+		return nil, invalidf("invalid date format, use YYYY-MM-DD")
+	}
+	end, err := time.Parse(dateLayout, opts.Window.End)
+	if err != nil {
+		return nil, invalidf("invalid date format, use YYYY-MM-DD")
+	}
+
+	expenses, err := s.GetTransactions(ctx, TransactionFilter{Type: "expense", EndDate: opts.Window.End, SortBy: "date", Ascending: true})
+	if err != nil {
+		return nil, err
+	}
+
+	from := start.AddDate(0, 0, -opts.History).Format(dateLayout)
+	byCategory := make(map[string][]float64)
+	byPayee := make(map[string][]float64)
+	var window []Transaction
+	for _, t := range expenses {
+		switch {
+		case t.Date >= opts.Window.Start:
+			window = append(window, t)
+		case t.Date >= from:
+			byCategory[t.Category] = append(byCategory[t.Category], t.Amount)
+			if p := payee(t); p != "" {
+				byPayee[p] = append(byPayee[p], t.Amount)
+			}
+		}
+	}
+
+	var anomalies []Anomaly
+	for _, t := range window {
+		if a, ok := outlier(t, byCategory, byPayee, opts.Sensitivity); ok {
+			anomalies = append(anomalies, a)
+		}
+	}
+	anomalies = append(anomalies, duplicates(expenses, start, opts.History)...)
+	anomalies = append(anomalies, newRecurring(expenses, start, end)...)
+
+	order := map[string]int{AnomalyOutlier: 0, AnomalyDuplicate: 1, AnomalyRecurring: 2}
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		a, b := anomalies[i], anomalies[j]
+		if a.Transaction.Date != b.Transaction.Date {
+			return a.Transaction.Date < b.Transaction.Date
+		}
+		if a.Transaction.ID != b.Transaction.ID {
+			return a.Transaction.ID < b.Transaction.ID
+		}
+		return order[a.Kind] < order[b.Kind]
+	})
+	return anomalies, nil
+}
+
+// outlier compares t with its payee when the payee is known well enough,
+// and with its category otherwise.
+func outlier(t Transaction, byCategory, byPayee map[string][]float64, sensitivity float64) (Anomaly, bool) {
+	group, amounts := "category "+t.Category, byCategory[t.Category]
+	earlier := byPayee[payee(t)]
+	switch {
+	case len(earlier) >= minPayeeSamples:
+		group, amounts = fmt.Sprintf("%q", t.Description), earlier
+	case len(earlier) > 0 && t.Amount <= 1.1*slices.Max(earlier):
+		// The payee has charged this much before, however unusual it is
+		// for the category.
+		return Anomaly{}, false
+	case len(amounts) < minCategorySamples:
+		return Anomaly{}, false
+	}
+	m := newAmountModel(amounts)
+	if m.score(t.Amount) <= sensitivity {
+		return Anomaly{}, false
+	}
+	return Anomaly{
+		Transaction: t,
+		Kind:        AnomalyOutlier,
+		Reason: fmt.Sprintf("$%.2f is %.1fx the usual $%.2f for %s (median of %d earlier expenses)",
+			t.Amount, t.Amount/m.median, m.median, group, m.count),
+	}, true
+}
+
+// duplicates flags expenses in the window from start that look like an
+// earlier one from a few days before, by the same test as FindDuplicates
+// with the default options, unless such charges normally come that often.
+// expenses are sorted by date; only those within history days of start,
+// plus the few days a duplicate can lag, are compared.
+func duplicates(expenses []Transaction, start time.Time, history int) []Anomaly {
+	opts, _ := DuplicateOptions{}.withDefaults()
+	windowStart := start.Format(dateLayout)
+	earliest := start.AddDate(0, 0, -history-opts.Days).Format(dateLayout)
+	first := sort.Search(len(expenses), func(i int) bool { return expenses[i].Date >= earliest })
+
+	var anomalies []Anomaly
+	for i := first; i < len(expenses); i++ {
+		t := expenses[i]
+		if t.Date < windowStart {
+			continue
+		}
+		var same []Transaction
+		for _, o := range expenses[first:i] {
+			if opts.alike(o, t) {
+				same = append(same, o)
+			}
+		}
+		if len(same) == 0 {
+			continue
+		}
+		prev := same[len(same)-1]
+		gap := daysBetween(prev.Date, t.Date)
+		if gap > opts.Days || frequent(same, opts.Days) {
+			continue
+		}
+		when := "the same day"
+		switch {
+		case gap == 1:
+			when = "1 day earlier"
+		case gap > 1:
+			when = fmt.Sprintf("%d days earlier", gap)
+		}
+		anomalies = append(anomalies, Anomaly{
+			Transaction: t,
+			Kind:        AnomalyDuplicate,
+			Reason:      fmt.Sprintf("same amount and category and a similar description as #%d on %s, %s", prev.ID, prev.Date, when),
+		})
+	}
+	return anomalies
+}
+
+// frequent reports whether alike charges usually come within days of each
+// other, like a daily coffee.
+func frequent(earlier []Transaction, days int) bool {
+	if len(earlier) < minPayeeSamples {
+		return false
+	}
+	var gaps []float64
+	for i := 1; i < len(earlier); i++ {
+		gaps = append(gaps, float64(daysBetween(earlier[i-1].Date, earlier[i].Date)))
+	}
+	return median(gaps) <= float64(days)
+}
+
+func daysBetween(from, to string) int {
+	a, _ := time.Parse(dateLayout, from)
+	b, _ := time.Parse(dateLayout, to)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// newRecurring flags the expense that made a series recurring, the one
+// that repeated it for the third time, when that happened within the
+// window.
+func newRecurring(expenses []Transaction, start, end time.Time) []Anomaly {
+	groups := make(map[string][]Transaction)
+	for _, t := range expenses {
+		groups[recurringKey(t)] = append(groups[recurringKey(t)], t)
+	}
+
+	var anomalies []Anomaly
+	for _, r := range DetectRecurring(expenses, end) {
+		group := groups[recurringKey(Transaction{Type: r.Type, Category: r.Category, Description: r.Description})]
+		third := group[minOccurrences-1]
+		if third.Date < start.Format(dateLayout) {
+			continue
+		}
+		anomalies = append(anomalies, Anomaly{
+			Transaction: third,
+			Kind:        AnomalyRecurring,
+			Reason: fmt.Sprintf("%s payment charged %d times since %s, about $%.2f each",
+				r.Interval, len(group), group[0].Date, r.Amount),
+		})
+	}
+	return anomalies
+}
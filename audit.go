@@ -0,0 +1,188 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"os/user"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type AuditEntry struct {
+	ID        int
+	CreatedAt string
+	User      string
+	Host      string
+	Command   string
+	Action    string
+	Entity    string
+	EntityID  int
+	Changes   map[string]FieldChange
+}
+
+type FieldChange struct {
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+type AuditFilter struct {
+	Entity    string
+	EntityID  int
+	User      string
+	StartDate string
+	EndDate   string
+	Limit     int
+}
+
+// actor identifies who is changing the database: Options.User if set, so
+// people sharing one login can still be told apart, else the OS account.
+func (s *SQLiteStore) actor() (string, string) {
+	name := s.opts.User
+	if name == "" {
+		if u, err := user.Current(); err == nil {
+			name = u.Username
+		}
+	}
+	if name == "" {
+		name = "unknown"
+	}
+	host, _ := os.Hostname()
+	return name, host
+}
+
+func createAuditTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS audit_log (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        created_at TEXT NOT NULL,
+        user TEXT NOT NULL,
+        host TEXT NOT NULL,
+        command TEXT NOT NULL,
+        action TEXT NOT NULL,
+        entity TEXT NOT NULL,
+        entity_id INTEGER NOT NULL,
+        changes TEXT
+    );
+    CREATE INDEX IF NOT EXISTS idx_audit_entity ON audit_log(entity, entity_id);
+    CREATE INDEX IF NOT EXISTS idx_audit_created_at ON audit_log(created_at);
+    CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+    BEGIN
+        SELECT RAISE(ABORT, 'audit_log is append-only');
+    END;
+    CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+    BEGIN
+        SELECT RAISE(ABORT, 'audit_log is append-only');
+    END;
+    `)
+	return err
+}
+
+func (s *SQLiteStore) writeAudit(ctx context.Context, tx *sql.Tx, action, entity string, entityID int, before, after interface{}) error {
+	changes, err := json.Marshal(diffFields(before, after))
+	if err != nil {
+		return err
+	}
+	userName, host := s.actor()
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO audit_log (created_at, user, host, command, action, entity, entity_id, changes)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		time.Now().Format("2006-01-02 15:04:05"), userName, host, s.opts.Command, action, entity, entityID, string(changes))
+	return err
+}
+
+// diffFields compares two row images field by field. Either side may be nil
+// for creations and deletions.
+func diffFields(before, after interface{}) map[string]FieldChange {
+	from := fieldMap(before)
+	to := fieldMap(after)
+
+	changes := make(map[string]FieldChange)
+	for name, value := range from {
+		if !reflect.DeepEqual(value, to[name]) && !(value == "" && to[name] == nil) {
+			changes[name] = FieldChange{From: value, To: to[name]}
+		}
+	}
+	for name, value := range to {
+		if _, ok := from[name]; !ok && value != "" {
+			changes[name] = FieldChange{To: value}
+		}
+	}
+	delete(changes, "ID")
+	delete(changes, "Version")
+	return changes
+}
+
+func fieldMap(row interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if row == nil {
+		return fields
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+func (s *SQLiteStore) GetAuditLog(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	query := "SELECT id, created_at, user, host, command, action, entity, entity_id, COALESCE(changes, '') FROM audit_log"
+	var conditions []string
+	var args []interface{}
+
+	if f.Entity != "" {
+		conditions = append(conditions, "entity = ?")
+		args = append(args, f.Entity)
+	}
+	if f.EntityID != 0 {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, f.EntityID)
+	}
+	if f.User != "" {
+		conditions = append(conditions, "user = ?")
+		args = append(args, f.User)
+	}
+	if f.StartDate != "" {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, f.StartDate)
+	}
+	if f.EndDate != "" {
+		conditions = append(conditions, "created_at < date(?, '+1 day')")
+		args = append(args, f.EndDate)
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var changes string
+		err = rows.Scan(&e.ID, &e.CreatedAt, &e.User, &e.Host, &e.Command, &e.Action, &e.Entity, &e.EntityID, &changes)
+		if err != nil {
+			return nil, err
+		}
+		if changes != "" {
+			if err = json.Unmarshal([]byte(changes), &e.Changes); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,271 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxAutoBackups = 10
+
+type BackupInfo struct {
+	Name    string
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Auto    bool
+}
+
+// BackupDir is the directory next to the database file that holds backups.
+func (s *SQLiteStore) BackupDir() string {
+	return filepath.Join(filepath.Dir(s.path), "backups")
+}
+
+// Backup writes a consistent copy of the open database to path using
+// VACUUM INTO, which is safe while other connections are using the file.
+// Encrypted databases are backed up encrypted with the current key.
+func (s *SQLiteStore) Backup(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return conflictf("backup file %s already exists", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if s.enc != nil {
+		dump, err := dumpDB(ctx, s.db)
+		if err != nil {
+			return err
+		}
+		return writeEncryptedFile(path, s.enc, dump)
+	}
+	_, err := s.db.ExecContext(ctx, "VACUUM INTO ?", path)
+	return err
+}
+
+// DefaultBackupPath names a new manual backup after the current time.
+func (s *SQLiteStore) DefaultBackupPath() string {
+	return filepath.Join(s.BackupDir(), "finance-"+time.Now().Format("20060102-150405")+".db")
+}
+
+// autoBackup snapshots the database before a destructive operation and
+// prunes older automatic snapshots so only the newest maxAutoBackups remain.
+func (s *SQLiteStore) autoBackup(ctx context.Context, reason string) (string, error) {
+	path := filepath.Join(s.BackupDir(),
+		fmt.Sprintf("auto-%s-%s.db", time.Now().Format("20060102-150405.000"), reason))
+	if err := s.Backup(ctx, path); err != nil {
+		return "", err
+	}
+
+	backups, err := s.ListBackups()
+	if err != nil {
+		return path, err
+	}
+	kept := 0
+	for _, b := range backups {
+		if !b.Auto {
+			continue
+		}
+		kept++
+		if kept > maxAutoBackups {
+			if err = os.Remove(b.Path); err != nil {
+				return path, err
+			}
+		}
+	}
+	return path, nil
+}
+
+// ListBackups returns the snapshots in the backup directory, newest first.
+func (s *SQLiteStore) ListBackups() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(s.BackupDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []BackupInfo
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".db" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, BackupInfo{
+			Name:    e.Name(),
+			Path:    filepath.Join(s.BackupDir(), e.Name()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Auto:    strings.HasPrefix(e.Name(), "auto-"),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].ModTime.Equal(backups[j].ModTime) {
+			return backups[i].ModTime.After(backups[j].ModTime)
+		}
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// resolveBackup accepts either a path or the name of a file in the backup
+// directory, as printed by ListBackups.
+func (s *SQLiteStore) resolveBackup(name string) (string, error) {
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	path := filepath.Join(s.BackupDir(), name)
+	if _, err := os.Stat(path); err != nil {
+		return "", notFoundf("backup %s not found", name)
+	}
+	return path, nil
+}
+
+func validateBackup(ctx context.Context, check *sql.DB) error {
+	var result string
+	if err := check.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&result); err != nil {
+		return invalidf("backup is not a readable database: %v", err)
+	}
+	if result != "ok" {
+		return invalidf("integrity check failed: %s", result)
+	}
+
+	var version int
+	if err := check.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		return invalidf("backup has schema version %d, this build supports up to %d", version, schemaVersion)
+	}
+
+	for _, table := range []string{"transactions", "budgets"} {
+		var name string
+		err := check.QueryRowContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return invalidf("backup is missing the %s table", table)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore validates a backup and copies its contents over those of the
+// current database. The current database is snapshotted first, so a
+// restore can itself be undone by restoring that snapshot, whose path is
+// returned. The copy happens in one transaction on the open database
+// rather than by swapping files, so other processes that have it open keep
+// working on the restored data, and the audit log is kept as it is.
+func (s *SQLiteStore) Restore(ctx context.Context, name string) (string, error) {
+	path, err := s.resolveBackup(name)
+	if err != nil {
+		return "", err
+	}
+	backup, err := s.openBackupFile(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer backup.Close()
+	if err = validateBackup(ctx, backup); err != nil {
+		return "", err
+	}
+
+	// The backup may predate the current schema; bring a private copy of
+	// it up to date so its tables match.
+	dump, err := dumpDB(ctx, backup)
+	if err != nil {
+		return "", err
+	}
+	restored, err := openDump(ctx, dump)
+	if err != nil {
+		return "", err
+	}
+	defer restored.Close()
+	if err = migrateDB(ctx, restored); err != nil {
+		return "", err
+	}
+
+	safety, err := s.autoBackup(ctx, "pre-restore")
+	if err != nil {
+		return "", fmt.Errorf("backup before restore failed: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	if err = copyTables(ctx, tx, restored); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if err = s.writeAudit(ctx, tx, "restore", "database", 0, nil, map[string]string{"Source": path}); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	return safety, s.commit(ctx, tx)
+}
+
+// copyTables replaces the rows of every table in tx's database with those
+// of the same table in src, except for the append-only audit_log. Id
+// sequences are left alone, so ids handed out since the backup are not
+// reused.
+func copyTables(ctx context.Context, tx *sql.Tx, src *sql.DB) error {
+	tables, err := queryStrings(ctx, tx,
+		"SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name <> 'audit_log' ORDER BY name")
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "PRAGMA defer_foreign_keys = ON"); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		columns, err := queryStrings(ctx, tx, "SELECT name FROM pragma_table_info(?) ORDER BY cid", table)
+		if err != nil {
+			return err
+		}
+		for i, c := range columns {
+			columns[i] = quoteIdent(c)
+		}
+		list := strings.Join(columns, ", ")
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM "+quoteIdent(table)); err != nil {
+			return err
+		}
+		rows, err := src.QueryContext(ctx, "SELECT "+list+" FROM "+quoteIdent(table))
+		if err != nil {
+			return err
+		}
+		insert := "INSERT INTO " + quoteIdent(table) + " (" + list + ") VALUES (" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		for rows.Next() {
+			if err = rows.Scan(pointers...); err == nil {
+				_, err = tx.ExecContext(ctx, insert, values...)
+			}
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("restoring %s: %w", table, err)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
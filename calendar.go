@@ -0,0 +1,39 @@
+package tracker
+
+import (
+	"context"
+	"time"
+)
+
+// DailySpending returns the expenses of every day in r that has any,
+// keyed by date.
+func DailySpending(ctx context.Context, s Store, r DateRange, where Filter) (map[string]float64, error) {
+	transactions, err := s.GetTransactions(ctx, TransactionFilter{Type: "expense", StartDate: r.Start, EndDate: r.End, Where: where})
+	if err != nil {
+		return nil, err
+	}
+	days := make(map[string]float64)
+	for _, t := range transactions {
+		days[t.Date] += t.Amount
+	}
+	return days, nil
+}
+
+// YearRange returns the dates of a calendar year.
+func YearRange(year int) DateRange {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return DateRange{start.Format(dateLayout), start.AddDate(1, 0, -1).Format(dateLayout)}
+}
+
+// DayThreshold is the default line above which a day counts as
+// overspent: twice the average of the days with any spending.
+func DayThreshold(days map[string]float64) float64 {
+	if len(days) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, amount := range days {
+		total += amount
+	}
+	return 2 * total / float64(len(days))
+}
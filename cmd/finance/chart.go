@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// chartStyle is what the terminal can show: its width, whether Unicode
+// block characters render and whether ANSI colours are on.
+type chartStyle struct {
+	width   int
+	unicode bool
+	color   bool
+}
+
+var (
+	unicodeBars   = []string{"▏", "▎", "▍", "▌", "▋", "▊", "▉", "█"}
+	unicodeSparks = []rune("▁▂▃▄▅▆▇█")
+	asciiSparks   = []rune("_.-:=+*#")
+)
+
+func detectChartStyle() chartStyle {
+	return chartStyle{width: terminalWidth(), unicode: unicodeSupported(), color: isColorSupported()}
+}
+
+func terminalWidth() int {
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return 80
+}
+
+// unicodeSupported guesses from the environment whether block characters
+// will render. FINANCE_ASCII forces plain ASCII. The classic Windows
+// console font lacks them, Windows Terminal does not.
+func unicodeSupported() bool {
+	if _, ascii := os.LookupEnv("FINANCE_ASCII"); ascii {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return os.Getenv("WT_SESSION") != ""
+	}
+	for _, env := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(env); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+	return false
+}
+
+// bar renders value out of max as a bar of at most width cells, with
+// eighth-cell precision in Unicode.
+func (st chartStyle) bar(value, max float64, width int) string {
+	if max <= 0 || value <= 0 || width <= 0 {
+		return ""
+	}
+	if !st.unicode {
+		return strings.Repeat("#", int(math.Round(math.Min(value/max, 1)*float64(width))))
+	}
+	eighths := int(math.Round(math.Min(value/max, 1) * float64(width*8)))
+	s := strings.Repeat(unicodeBars[7], eighths/8)
+	if eighths%8 > 0 {
+		s += unicodeBars[eighths%8-1]
+	}
+	return s
+}
+
+// barChart renders one horizontal bar per label, scaled to the largest
+// value and the terminal width.
+func (st chartStyle) barChart(labels []string, values []float64, color string) string {
+	labelWidth := 0
+	for _, l := range labels {
+		labelWidth = max(labelWidth, utf8.RuneCountInString(l))
+	}
+	labelWidth = min(labelWidth, 20)
+	maxValue, valueWidth := 0.0, 0
+	for _, v := range values {
+		maxValue = math.Max(maxValue, v)
+		valueWidth = max(valueWidth, len(fmt.Sprintf("%.2f", v)))
+	}
+	barWidth := max(st.width-labelWidth-valueWidth-6, 10)
+
+	reset := ""
+	if st.color && color != "" {
+		reset = colorReset
+	} else {
+		color = ""
+	}
+	var b strings.Builder
+	for i, l := range labels {
+		if utf8.RuneCountInString(l) > labelWidth {
+			l = string([]rune(l)[:labelWidth-1]) + "…"
+		}
+		fmt.Fprintf(&b, " %-*s %*.2f %s%s%s\n", labelWidth, l, valueWidth, values[i], color, st.bar(values[i], maxValue, barWidth), reset)
+	}
+	return b.String()
+}
+
+// sparkline renders values as one character each, scaled between their
+// minimum and maximum.
+func (st chartStyle) sparkline(values []float64) string {
+	levels := asciiSparks
+	if st.unicode {
+		levels = unicodeSparks
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		level := 0
+		if hi > lo {
+			level = int(math.Round((v - lo) / (hi - lo) * float64(len(levels)-1)))
+		}
+		b.WriteRune(levels[level])
+	}
+	return b.String()
+}
+
+type chartSeries struct {
+	name   string
+	values []float64
+	color  string
+}
+
+// lineChart plots series sharing the x labels on a grid height rows tall,
+// joining consecutive points with straight lines. The y axis starts at
+// zero unless a value is negative.
+func (st chartStyle) lineChart(labels []string, series []chartSeries, height int) string {
+	lo, hi := 0.0, 0.0
+	for _, s := range series {
+		for _, v := range s.values {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+
+	if len(labels) == 0 {
+		return ""
+	}
+	axisWidth := max(len(fmt.Sprintf("%.0f", hi)), len(fmt.Sprintf("%.0f", lo)))
+	step := max((st.width-axisWidth-4)/len(labels), 1)
+	columns := step*(len(labels)-1) + 1
+
+	markers := []string{"●", "◆", "▲", "■"}
+	dot := "·"
+	if !st.unicode {
+		markers = []string{"*", "o", "x", "+"}
+		dot = "."
+	}
+
+	row := func(v float64) int {
+		return int(math.Round((hi - v) / (hi - lo) * float64(height-1)))
+	}
+	grid := make([][]string, height)
+	for y := range grid {
+		grid[y] = make([]string, columns)
+		for x := range grid[y] {
+			grid[y][x] = " "
+		}
+	}
+	for i, s := range series {
+		marker := markers[i%len(markers)]
+		line := dot
+		if st.color && s.color != "" {
+			marker = s.color + marker + colorReset
+			line = s.color + line + colorReset
+		}
+		prev := row(s.values[0])
+		for x := 0; x < columns; x++ {
+			p, frac := x/step, float64(x%step)/float64(step)
+			v := s.values[p]
+			if frac > 0 {
+				v += (s.values[p+1] - v) * frac
+			}
+			r := row(v)
+			// Fill the rows between neighbouring columns so that steep
+			// segments stay connected.
+			from, to := min(prev, r), max(prev, r)
+			if frac == 0 && x > 0 {
+				from, to = min(prev+1, r), max(prev-1, r)
+			}
+			for y := from; y <= to; y++ {
+				if grid[y][x] == " " {
+					grid[y][x] = line
+				}
+			}
+			if frac == 0 {
+				grid[r][x] = marker
+			}
+			prev = r
+		}
+	}
+
+	var b strings.Builder
+	for y, cells := range grid {
+		label := ""
+		switch y {
+		case 0:
+			label = fmt.Sprintf("%.0f", hi)
+		case height - 1:
+			label = fmt.Sprintf("%.0f", lo)
+		case (height - 1) / 2:
+			label = fmt.Sprintf("%.0f", (hi+lo)/2)
+		}
+		fmt.Fprintf(&b, "%*s ┤%s\n", axisWidth, label, strings.Join(cells, ""))
+	}
+	if !st.unicode {
+		s := b.String()
+		b.Reset()
+		b.WriteString(strings.ReplaceAll(s, "┤", "|"))
+	}
+
+	fmt.Fprintf(&b, "%*s  ", axisWidth, "")
+	axis := []rune(strings.Repeat(" ", columns+step))
+	// Label every point that has room, left-aligned under it.
+	every := len(labels[0])/step + 1
+	for i, l := range labels {
+		if i%every == 0 && i*step+len(l) <= len(axis) {
+			copy(axis[i*step:], []rune(l))
+		}
+	}
+	b.WriteString(strings.TrimRight(string(axis), " ") + "\n")
+
+	var legend []string
+	for i, s := range series {
+		marker := markers[i%len(markers)]
+		if st.color && s.color != "" {
+			marker = s.color + marker + colorReset
+		}
+		legend = append(legend, marker+" "+s.name)
+	}
+	fmt.Fprintf(&b, "%*s  %s\n", axisWidth, "", strings.Join(legend, "   "))
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSparkline(t *testing.T) {
+	values := []float64{0, 50, 100, 100}
+	if got := (chartStyle{unicode: true}).sparkline(values); got != "▁▅██" {
+		t.Errorf("unicode sparkline = %q", got)
+	}
+	if got := (chartStyle{}).sparkline(values); got != "_=##" {
+		t.Errorf("ascii sparkline = %q", got)
+	}
+	if got := (chartStyle{}).sparkline([]float64{3, 3}); got != "__" {
+		t.Errorf("flat sparkline = %q", got)
+	}
+}
+
+func TestBar(t *testing.T) {
+	tests := []struct {
+		style chartStyle
+		value float64
+		want  string
+	}{
+		{chartStyle{unicode: true}, 50, "█████"},
+		{chartStyle{unicode: true}, 55, "█████▌"},
+		{chartStyle{unicode: true}, 200, "██████████"},
+		{chartStyle{}, 55, "######"},
+		{chartStyle{}, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.style.bar(tt.value, 100, 10); got != tt.want {
+			t.Errorf("bar(%v, unicode %v) = %q, want %q", tt.value, tt.style.unicode, got, tt.want)
+		}
+	}
+}
+
+func TestBarChartFitsWidth(t *testing.T) {
+	st := chartStyle{width: 40}
+	out := st.barChart([]string{"groceries", "a-very-long-category-name"}, []float64{100, 25}, colorRed)
+	if strings.Contains(out, "\033") {
+		t.Error("colour codes without colour support")
+	}
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if n := len([]rune(line)); n > st.width {
+			t.Errorf("line %q is %d wide, terminal is %d", line, n, st.width)
+		}
+	}
+}
+
+func TestLineChartASCII(t *testing.T) {
+	st := chartStyle{width: 40}
+	out := st.lineChart([]string{"2026-01", "2026-02", "2026-03"}, []chartSeries{
+		{name: "Income", values: []float64{100, 200, 150}},
+		{name: "Expense", values: []float64{50, 80, 300}},
+	}, 6)
+	for _, r := range out {
+		if r > 127 {
+			t.Fatalf("non-ASCII %q in chart:\n%s", r, out)
+		}
+	}
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(lines) != 8 {
+		t.Fatalf("got %d lines, want 6 rows, labels and legend:\n%s", len(lines), out)
+	}
+	if !strings.HasPrefix(lines[0], "300 |") || !strings.HasPrefix(lines[5], "  0 |") {
+		t.Errorf("unexpected axis:\n%s", out)
+	}
+	if !strings.Contains(lines[6], "2026-01") || !strings.Contains(lines[7], "* Income") {
+		t.Errorf("unexpected labels or legend:\n%s", out)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+// enableANSISupport is only needed on Windows; other terminals understand
+// ANSI escapes out of the box.
+func enableANSISupport() {}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func enableANSISupport() {
+	enableForHandle(os.Stdout)
+	enableForHandle(os.Stderr)
+}
+
+func enableForHandle(f *os.File) {
+	handle := windows.Handle(f.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return
+	}
+	const enableVirtualTerminalProcessing uint32 = 0x0004
+	windows.SetConsoleMode(handle, mode|enableVirtualTerminalProcessing)
+}
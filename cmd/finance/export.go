@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/MusticDaubi/tracker"
+)
+
+// exportedTransaction is how a transaction looks in a JSON export.
+type exportedTransaction struct {
+	ID          int     `json:"id"`
+	Date        string  `json:"date"`
+	Type        string  `json:"type"`
+	Category    string  `json:"category"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description"`
+}
+
+func writeExport(w io.Writer, format string, transactions []tracker.Transaction) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "date", "type", "category", "amount", "description"}); err != nil {
+			return err
+		}
+		for _, t := range transactions {
+			record := []string{strconv.Itoa(t.ID), t.Date, t.Type, t.Category, strconv.FormatFloat(t.Amount, 'f', 2, 64), t.Description}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		exported := make([]exportedTransaction, len(transactions))
+		for i, t := range transactions {
+			exported[i] = exportedTransaction{t.ID, t.Date, t.Type, t.Category, t.Amount, t.Description}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(exported)
+	default:
+		return fmt.Errorf("unknown format %q, use csv or json", format)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MusticDaubi/tracker"
+)
+
+func TestWriteExport(t *testing.T) {
+	transactions := []tracker.Transaction{
+		{ID: 1, Type: "expense", Category: "food", Amount: 12.5, Description: "coffee, beans", Date: "2026-01-03"},
+		{ID: 2, Type: "income", Category: "salary", Amount: 2500, Date: "2026-01-01"},
+	}
+
+	var b strings.Builder
+	if err := writeExport(&b, "csv", transactions); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,date,type,category,amount,description\n" +
+		"1,2026-01-03,expense,food,12.50,\"coffee, beans\"\n" +
+		"2,2026-01-01,income,salary,2500.00,\n"
+	if b.String() != want {
+		t.Errorf("csv export = %q, want %q", b.String(), want)
+	}
+
+	b.Reset()
+	if err := writeExport(&b, "json", transactions[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"category": "salary"`) || !strings.Contains(b.String(), `"amount": 2500`) {
+		t.Errorf("json export = %s", b.String())
+	}
+
+	if err := writeExport(&b, "xml", transactions); err == nil {
+		t.Error("export to an unknown format succeeded")
+	}
+}
@@ -0,0 +1,2623 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MusticDaubi/tracker"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+	colorBold   = "\033[1m"
+)
+
+const dbPath = "./finance.db"
+
+var store *tracker.SQLiteStore
+
+func main() {
+	if runtime.GOOS == "windows" {
+		enableANSISupport()
+	}
+
+	ctx := context.Background()
+	var err error
+	store, err = tracker.Open(ctx, dbPath, tracker.Options{
+		Passphrase: func(prompt string) (string, error) { return readPassphrase(prompt, false) },
+		Command:    commandLine(os.Args[1:]),
+		User:       os.Getenv("FINANCE_USER"),
+	})
+	if err != nil {
+		fatal("Database initialization failed: ", err)
+	}
+	defer store.Close()
+
+	addCmd := flag.NewFlagSet("add", flag.ExitOnError)
+	addType := addCmd.String("type", "", "Transaction type (income/expense)")
+	addCategory := addCmd.String("category", "", "Category (optional when a rule assigns one)")
+	addAmount := addCmd.Float64("amount", 0, "Amount")
+	addDesc := addCmd.String("desc", "", "Description")
+	addTags := addCmd.String("tags", "", "Comma-separated tags, e.g. travel,work")
+	addDate := addCmd.String("date", "", "Date (YYYY-MM-DD)")
+	addYes := addCmd.Bool("yes", false, "Add even if it looks like a duplicate, without asking")
+
+	listCmd := flag.NewFlagSet("list", flag.ExitOnError)
+	listFilter := addFilterFlags(listCmd)
+	listLimit := listCmd.Int("limit", 0, "Limit number of results")
+	listOffset := listCmd.Int("offset", 0, "Skip this many results (for paging)")
+	listSort := listCmd.String("sort", "date", "Sort by (date/amount/category/id)")
+	listAsc := listCmd.Bool("asc", false, "Sort ascending")
+	listDesc := listCmd.Bool("desc", false, "Sort descending (default)")
+
+	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+	exportFilter := addFilterFlags(exportCmd)
+	exportFormat := exportCmd.String("format", "csv", "Output format (csv/json)")
+	exportOutput := exportCmd.String("o", "", "Write to this file instead of standard output")
+
+	updateCmd := flag.NewFlagSet("update", flag.ExitOnError)
+	updateID := updateCmd.Int("id", 0, "Transaction ID to update")
+	updateFilter := addFilterFlags(updateCmd)
+	updateCmd.Lookup("type").Usage = "New transaction type with -id; filter by type without it"
+	updateCmd.Lookup("category").Usage = "New category with -id; filter by category without it"
+	updateAmount := updateCmd.Float64("amount", -1, "New amount (use -1 to keep unchanged)")
+	updateDesc := updateCmd.String("desc", "", "New description")
+	updateDate := updateCmd.String("date", "", "New date (YYYY-MM-DD)")
+	updateVersion := updateCmd.Int("version", 0, "Only update if the transaction is still at this version (see list)")
+	var updateSet assignmentList
+	updateCmd.Var(&updateSet, "set", "Field assignment such as category=food for every matching transaction (repeatable)")
+	updateYes := updateCmd.Bool("yes", false, "Skip the confirmation prompt for updates by filter")
+
+	deleteCmd := flag.NewFlagSet("delete", flag.ExitOnError)
+	deleteID := deleteCmd.Int("id", 0, "Transaction ID to delete")
+	deleteFilter := addFilterFlags(deleteCmd)
+	deleteYes := deleteCmd.Bool("yes", false, "Skip the confirmation prompt for deletes by filter")
+
+	statsCmd := flag.NewFlagSet("stats", flag.ExitOnError)
+	statsPeriod := statsCmd.String("period", "all", "Time period (day/week/month/year/all)")
+	statsStartDate := statsCmd.String("start", "", "Custom start date (YYYY-MM-DD)")
+	statsEndDate := statsCmd.String("end", "", "Custom end date (YYYY-MM-DD)")
+	statsWhere := statsCmd.String("where", "", "Filter expression, e.g. 'desc ~ \"coffee\" and date >= 2026-01-01'")
+
+	trendsCmd := flag.NewFlagSet("trends", flag.ExitOnError)
+	trendsBy := trendsCmd.String("by", "month", "Bucket size (month/quarter/year)")
+	trendsMonths := trendsCmd.Int("months", 12, "Number of months to cover")
+	trendsTop := trendsCmd.Int("top", 3, "Number of fastest growing categories to highlight")
+	trendsWhere := trendsCmd.String("where", "", "Filter expression, e.g. 'category != rent'")
+	trendsChart := trendsCmd.Bool("chart", false, "Also plot income and expenses as a line chart")
+
+	forecastCmd := flag.NewFlagSet("forecast", flag.ExitOnError)
+	forecastDays := forecastCmd.Int("days", 90, "Number of days to project")
+	forecastHistory := forecastCmd.Int("history", 90, "Number of past days to learn spending from")
+	forecastBalance := forecastCmd.Float64("balance", 0, "Starting balance (default income minus expenses recorded up to today)")
+	forecastChart := forecastCmd.Bool("chart", false, "Also plot the projected balance")
+
+	dedupeCmd := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	dedupeStart := dedupeCmd.String("start", "", "Start date (YYYY-MM-DD)")
+	dedupeEnd := dedupeCmd.String("end", "", "End date (YYYY-MM-DD)")
+	dedupeDays := dedupeCmd.Int("days", 3, "How many days apart duplicates may be")
+	dedupeTolerance := dedupeCmd.Float64("tolerance", 0, "How far apart amounts may be, as a fraction (0.01 = 1%)")
+	dedupeSimilarity := dedupeCmd.Float64("similarity", 0.8, "How alike descriptions must be, from 0 to 1")
+	dedupeList := dedupeCmd.Bool("list", false, "Only list the duplicates, without asking what to do")
+
+	anomaliesCmd := flag.NewFlagSet("anomalies", flag.ExitOnError)
+	anomaliesDays := anomaliesCmd.Int("days", 30, "Check expenses from the last N days")
+	anomaliesHistory := anomaliesCmd.Int("history", 365, "Number of earlier days to learn typical amounts from")
+	anomaliesSensitivity := anomaliesCmd.Float64("sensitivity", 3.5, "Deviations above the usual amount that count as an outlier; lower flags more")
+
+	calendarCmd := flag.NewFlagSet("calendar", flag.ExitOnError)
+	calendarYear := calendarCmd.Int("year", time.Now().Year(), "Year of the heatmap")
+	calendarMonth := calendarCmd.String("month", "", "Show one month (YYYY-MM) with daily totals instead")
+	calendarThreshold := calendarCmd.Float64("threshold", 0, "Mark days spending more than this (default twice the daily average)")
+	calendarWhere := calendarCmd.String("where", "", "Filter expression, e.g. 'category != rent'")
+
+	budgetCmd := flag.NewFlagSet("budget", flag.ExitOnError)
+	budgetAdd := budgetCmd.Bool("add", false, "Add new budget")
+	budgetList := budgetCmd.Bool("list", false, "List all budgets")
+	budgetRemove := budgetCmd.Bool("remove", false, "Remove budget")
+	budgetCategory := budgetCmd.String("category", "", "Budget category")
+	budgetAmount := budgetCmd.Float64("amount", 0, "Budget amount")
+	budgetPeriod := budgetCmd.String("period", "monthly", "Budget period (weekly/biweekly/monthly/quarterly/yearly or days, e.g. 10d)")
+	budgetAnchor := budgetCmd.String("anchor", "", "A date a period starts on, e.g. 2026-01-15 for months from the 15th (default: calendar weeks from Monday, months from the 1st)")
+	budgetStart := budgetCmd.String("start", "", "Start date (YYYY-MM-DD)")
+	budgetEnd := budgetCmd.String("end", "", "End date (YYYY-MM-DD)")
+	budgetRollover := budgetCmd.String("rollover", "none", "What carries into the next period: none, surplus, both (surplus and overspend) or capped (needs -start)")
+	budgetCap := budgetCmd.Float64("cap", 0, "Most surplus carried with -rollover capped")
+	budgetAlerts := budgetCmd.String("alerts", "", "Alert thresholds in percent of the limit, e.g. 50,90,100 (default: 90,100)")
+
+	envelopeShowCmd := flag.NewFlagSet("envelope show", flag.ExitOnError)
+	envelopeShowDate := envelopeShowCmd.String("date", "", "Show the periods containing this date (default: today)")
+
+	envelopeMoveCmd := flag.NewFlagSet("envelope move", flag.ExitOnError)
+	envelopeMoveFrom := envelopeMoveCmd.String("from", "", "Category to take money from")
+	envelopeMoveTo := envelopeMoveCmd.String("to", "", "Category to move money to")
+	envelopeMoveAmount := envelopeMoveCmd.Float64("amount", 0, "Amount to move")
+	envelopeMoveDate := envelopeMoveCmd.String("date", time.Now().Format("2006-01-02"), "Date of the move (YYYY-MM-DD)")
+	envelopeMoveNote := envelopeMoveCmd.String("note", "", "Note")
+
+	envelopeHistoryCmd := flag.NewFlagSet("envelope history", flag.ExitOnError)
+	envelopeHistoryStart := envelopeHistoryCmd.String("start", "", "Start date (YYYY-MM-DD)")
+	envelopeHistoryEnd := envelopeHistoryCmd.String("end", "", "End date (YYYY-MM-DD)")
+
+	goalAddCmd := flag.NewFlagSet("goal add", flag.ExitOnError)
+	goalAddName := goalAddCmd.String("name", "", "Goal name")
+	goalAddKind := goalAddCmd.String("kind", tracker.GoalSavings, "savings (money put into -category, or the balance without one) or income (income in -category, or all income)")
+	goalAddTarget := goalAddCmd.Float64("target", 0, "Target amount")
+	goalAddBy := goalAddCmd.String("by", "", "Target date (YYYY-MM-DD)")
+	goalAddCategory := goalAddCmd.String("category", "", "Linked category")
+	goalAddStart := goalAddCmd.String("start", "", "Count contributions from this date (YYYY-MM-DD, default: all history)")
+
+	goalRemoveCmd := flag.NewFlagSet("goal remove", flag.ExitOnError)
+	goalRemoveName := goalRemoveCmd.String("name", "", "Goal name")
+
+	planShowCmd := flag.NewFlagSet("plan show", flag.ExitOnError)
+	planShowMonth := planShowCmd.String("month", time.Now().Format("2006-01"), "Month (YYYY-MM)")
+
+	planAssignCmd := flag.NewFlagSet("plan assign", flag.ExitOnError)
+	planAssignMonth := planAssignCmd.String("month", time.Now().Format("2006-01"), "Month (YYYY-MM)")
+	planAssignCategory := planAssignCmd.String("category", "", "Category")
+	planAssignAmount := planAssignCmd.Float64("amount", -1, "Amount to assign (0 removes the assignment)")
+
+	alertsAddCmd := flag.NewFlagSet("alerts add", flag.ExitOnError)
+	alertsAddKind := alertsAddCmd.String("kind", "", "Notifier: desktop, smtp, webhook or command")
+	alertsAddTarget := alertsAddCmd.String("target", "", "Recipients for smtp (comma-separated), URL for webhook, shell command for command")
+	alertsAddServer := alertsAddCmd.String("server", "", "SMTP server (default: localhost:25)")
+
+	alertsRemoveCmd := flag.NewFlagSet("alerts remove", flag.ExitOnError)
+	alertsRemoveID := alertsRemoveCmd.Int("id", 0, "Notifier ID")
+
+	alertsTestCmd := flag.NewFlagSet("alerts test", flag.ExitOnError)
+	alertsTestID := alertsTestCmd.Int("id", 0, "Only test this notifier")
+
+	alertsHistoryCmd := flag.NewFlagSet("alerts history", flag.ExitOnError)
+	alertsHistoryLimit := alertsHistoryCmd.Int("limit", 20, "Number of alerts to show (0 for all)")
+
+	rulesAddCmd := flag.NewFlagSet("rules add", flag.ExitOnError)
+	rulesAddType := rulesAddCmd.String("type", "", "Only match this type (income/expense)")
+	rulesAddPattern := rulesAddCmd.String("pattern", "", "Regular expression to search for in the description, e.g. '(?i)^amzn'")
+	rulesAddPayee := rulesAddCmd.String("payee", "", "Match this whole description, ignoring case")
+	rulesAddMin := rulesAddCmd.Float64("min", 0, "Minimum amount")
+	rulesAddMax := rulesAddCmd.Float64("max", 0, "Maximum amount")
+	rulesAddCategory := rulesAddCmd.String("category", "", "Category to assign")
+	rulesAddTags := rulesAddCmd.String("tags", "", "Comma-separated tags to add")
+	rulesAddRewrite := rulesAddCmd.String("rewrite", "", "New description; $1 or ${name} insert groups of -pattern")
+
+	rulesRemoveCmd := flag.NewFlagSet("rules remove", flag.ExitOnError)
+	rulesRemoveID := rulesRemoveCmd.Int("id", 0, "Rule ID")
+
+	rulesTestCmd := flag.NewFlagSet("rules test", flag.ExitOnError)
+	rulesTestType := rulesTestCmd.String("type", "expense", "Transaction type (income/expense)")
+	rulesTestDesc := rulesTestCmd.String("desc", "", "Description")
+	rulesTestAmount := rulesTestCmd.Float64("amount", 0, "Amount")
+
+	rulesApplyCmd := flag.NewFlagSet("rules apply", flag.ExitOnError)
+	rulesApplyWhere := rulesApplyCmd.String("where", "", "Only re-apply to transactions matching this filter expression")
+	rulesApplyYes := rulesApplyCmd.Bool("yes", false, "Skip the confirmation prompt")
+
+	resetCmd := flag.NewFlagSet("reset", flag.ExitOnError)
+	resetConfirm := resetCmd.Bool("confirm", false, "Confirm database reset")
+
+	undoCmd := flag.NewFlagSet("undo", flag.ExitOnError)
+	undoCount := undoCmd.Int("n", 1, "Number of operations to undo")
+
+	redoCmd := flag.NewFlagSet("redo", flag.ExitOnError)
+	redoCount := redoCmd.Int("n", 1, "Number of operations to redo")
+
+	trashListCmd := flag.NewFlagSet("trash list", flag.ExitOnError)
+	trashListLimit := trashListCmd.Int("limit", 0, "Limit number of results")
+
+	trashRestoreCmd := flag.NewFlagSet("trash restore", flag.ExitOnError)
+	trashRestoreID := trashRestoreCmd.Int("id", 0, "Transaction ID to restore")
+
+	trashEmptyCmd := flag.NewFlagSet("trash empty", flag.ExitOnError)
+	trashEmptyOlderThan := trashEmptyCmd.String("older-than", "", "Only remove items deleted at least this long ago (e.g. 30d, 12h)")
+	trashEmptyYes := trashEmptyCmd.Bool("yes", false, "Skip the confirmation prompt")
+
+	backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	backupOutput := backupCmd.String("o", "", "Backup file (default: backups/finance-<timestamp>.db)")
+	backupList := backupCmd.Bool("list", false, "List available backups")
+
+	restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreYes := restoreCmd.Bool("yes", false, "Skip the confirmation prompt")
+
+	decryptCmd := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	decryptYes := decryptCmd.Bool("yes", false, "Skip the confirmation prompt")
+
+	auditCmd := flag.NewFlagSet("audit", flag.ExitOnError)
+	auditEntity := auditCmd.String("entity", "", "Filter by entity (transactions/budgets/budget_moves/goals/assignments/notifiers/rules/database)")
+	auditID := auditCmd.Int("id", 0, "Filter by entity ID")
+	auditUser := auditCmd.String("user", "", "Filter by user")
+	auditStart := auditCmd.String("start", "", "Start date (YYYY-MM-DD)")
+	auditEnd := auditCmd.String("end", "", "End date (YYYY-MM-DD)")
+	auditLimit := auditCmd.Int("limit", 50, "Limit number of results (0 for all)")
+
+	historyCmd := flag.NewFlagSet("history", flag.ExitOnError)
+	historyLimit := historyCmd.Int("limit", 20, "Number of operations to show (0 for all)")
+	historyID := historyCmd.Int("id", 0, "Show the row changes of one operation")
+
+	if len(os.Args) < 2 {
+		printHelp()
+		fmt.Println("\nThe application will now close.")
+		fmt.Println("To use the application, open a command prompt and run:")
+		fmt.Println("finance.exe [command] [flags]")
+		fmt.Println("\nPress Enter to exit...")
+		fmt.Scanln()
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "add":
+		err := addCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		transaction := tracker.Transaction{
+			Type:        *addType,
+			Category:    *addCategory,
+			Amount:      *addAmount,
+			Description: *addDesc,
+			Tags:        *addTags,
+			Date:        *addDate,
+		}
+		// Rules fill in the category, add tags and clean up the
+		// description; a category given by hand wins.
+		rules, err := store.GetRules(ctx)
+		if err != nil {
+			fatal("", err)
+		}
+		if categorized, id := tracker.ApplyRules(rules, transaction); id != 0 {
+			if *addCategory != "" {
+				categorized.Category = *addCategory
+			}
+			if categorized != transaction {
+				fmt.Printf("Rule #%d applied: category %s, tags %q, description %q\n", id, categorized.Category, categorized.Tags, categorized.Description)
+			}
+			transaction = categorized
+		}
+		if err = tracker.ValidateTransaction(transaction); err != nil {
+			fatal("Validation error: ", err)
+		}
+		if !*addYes {
+			duplicates, err := tracker.PossibleDuplicates(ctx, store, transaction, tracker.DuplicateOptions{})
+			if err != nil {
+				fatal("", err)
+			}
+			if len(duplicates) > 0 {
+				fmt.Println("Warning: this looks like a transaction that is already recorded:")
+				printTransactionTable(duplicates)
+				if !confirm("Add it anyway? [y/N]: ") {
+					fmt.Println("Aborted")
+					return
+				}
+			}
+		}
+		if _, err = store.AddTransaction(ctx, transaction); err != nil {
+			fatal("", err)
+		}
+		if transaction.Type == "expense" {
+			date, _ := time.Parse("2006-01-02", transaction.Date)
+			checkAlerts(ctx, transaction.Category, date)
+		}
+		fmt.Println("Transaction added successfully!")
+	case "reset":
+		err := resetCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		if !*resetConfirm {
+			fmt.Println("Warning: This will delete all data! Use -confirm to proceed")
+			fmt.Println("A backup is written to the backups folder before the reset.")
+			return
+		}
+		if err = store.Reset(ctx); err != nil {
+			fatal("Reset error: ", err)
+		}
+		fmt.Println("Database reset successfully")
+
+	case "list":
+		err := listCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		filter := listFilter.filter()
+		if *listAsc && *listDesc {
+			usageError("Error: -asc and -desc cannot be used together")
+		}
+		if *listLimit < 0 || *listOffset < 0 {
+			usageError("Error: -limit and -offset cannot be negative")
+		}
+		filter.SortBy = *listSort
+		filter.Ascending = *listAsc
+		filter.Limit = *listLimit
+		filter.Offset = *listOffset
+		transactions, err := store.GetTransactions(ctx, filter)
+		if err != nil {
+			fatal("", err)
+		}
+		totals, err := store.GetTransactionTotals(ctx, filter)
+		if err != nil {
+			fatal("", err)
+		}
+		printTransactions(transactions, filter.Offset, totals)
+
+	case "export":
+		err := exportCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		if *exportFormat != "csv" && *exportFormat != "json" {
+			usageError("Error: -format must be csv or json")
+		}
+		filter := exportFilter.filter()
+		filter.SortBy = "date"
+		filter.Ascending = true
+		transactions, err := store.GetTransactions(ctx, filter)
+		if err != nil {
+			fatal("", err)
+		}
+		out := os.Stdout
+		if *exportOutput != "" {
+			if out, err = os.Create(*exportOutput); err != nil {
+				fatal("Export error: ", err)
+			}
+		}
+		if err = writeExport(out, *exportFormat, transactions); err == nil && out != os.Stdout {
+			err = out.Close()
+		}
+		if err != nil {
+			fatal("Export error: ", err)
+		}
+		if out != os.Stdout {
+			fmt.Printf("Exported %d transaction(s) to %s\n", len(transactions), *exportOutput)
+		}
+
+	case "update":
+		err := updateCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		filter := updateFilter.filter()
+		if *updateID == 0 {
+			// Without -id the filter flags select the transactions and
+			// -set gives the new values.
+			if filterIsEmpty(filter) {
+				usageError("Error: Transaction ID or a filter is required")
+			}
+			if len(updateSet) == 0 {
+				usageError("Error: use -set to give the new values for an update by filter")
+			}
+			if *updateAmount != -1 || *updateDesc != "" || *updateDate != "" || *updateVersion != 0 {
+				usageError("Error: -amount, -desc, -date and -version only apply to updates by -id; use -set")
+			}
+		} else if filter.StartDate != "" || filter.EndDate != "" || filter.MinAmount != 0 || filter.MaxAmount != 0 || !filter.Where.IsEmpty() {
+			usageError("Error: -id cannot be combined with filters")
+		}
+
+		update := tracker.Transaction{
+			Amount:      *updateAmount,
+			Description: *updateDesc,
+			Date:        *updateDate,
+			Version:     *updateVersion,
+		}
+		if *updateID != 0 {
+			update.Type = filter.Type
+			update.Category = filter.Category
+		}
+		if err = applyAssignments(&update, updateSet); err != nil {
+			usageError("Invalid -set: " + err.Error())
+		}
+
+		// The store takes 0 to mean unchanged, but asked for on the
+		// command line it is a mistake.
+		if *updateAmount == 0 {
+			usageError("Validation error: amount must be positive")
+		}
+		if err = tracker.ValidatePatch(update); err != nil {
+			usageError("Validation error: " + err.Error())
+		}
+
+		if *updateID != 0 {
+			if err = store.UpdateTransaction(ctx, *updateID, update); err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Transaction #%d updated successfully!\n", *updateID)
+			return
+		}
+
+		versions, ok := previewBulk(ctx, filter, "Update", *updateYes)
+		if !ok {
+			return
+		}
+		affected, err := store.BulkUpdateTransactions(ctx, versions, update)
+		if err != nil {
+			fatal("", err)
+		}
+		fmt.Printf("%d transaction(s) updated successfully!\n", affected)
+
+	case "delete":
+		err := deleteCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		filter := deleteFilter.filter()
+		if *deleteID == 0 && filterIsEmpty(filter) {
+			usageError("Error: Transaction ID or a filter is required")
+		}
+		if *deleteID != 0 && !filterIsEmpty(filter) {
+			usageError("Error: -id cannot be combined with filters")
+		}
+
+		if *deleteID != 0 {
+			if err = store.DeleteTransaction(ctx, *deleteID); err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Transaction #%d moved to trash\n", *deleteID)
+			return
+		}
+
+		versions, ok := previewBulk(ctx, filter, "Delete", *deleteYes)
+		if !ok {
+			return
+		}
+		affected, err := store.BulkDeleteTransactions(ctx, versions)
+		if err != nil {
+			fatal("", err)
+		}
+		fmt.Printf("%d transaction(s) moved to trash\n", affected)
+
+	case "stats":
+		err := statsCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		where, err := tracker.ParseFilter(*statsWhere)
+		if err != nil {
+			fatal("Invalid -where expression: ", err)
+		}
+		period, err := tracker.PeriodRange(*statsPeriod, *statsStartDate, *statsEndDate, time.Now())
+		if err != nil {
+			fatal("", err)
+		}
+		income, expense, err := store.GetBalance(ctx, period, where)
+		if err != nil {
+			fatal("", err)
+		}
+
+		stats, err := store.GetCategoryStats(ctx, period, where)
+		if err != nil {
+			fatal("", err)
+		}
+
+		printStatistics(ctx, period, where, income, expense, stats)
+	case "trends":
+		err := trendsCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		where, err := tracker.ParseFilter(*trendsWhere)
+		if err != nil {
+			fatal("Invalid -where expression: ", err)
+		}
+		trends, err := tracker.Trends(ctx, store, *trendsBy, *trendsMonths, time.Now(), where)
+		if err != nil {
+			fatal("", err)
+		}
+		printTrends(*trendsBy, trends, *trendsTop)
+		if *trendsChart {
+			printTrendsChart(trends)
+		}
+	case "forecast":
+		err := forecastCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		now := time.Now()
+		balance := *forecastBalance
+		balanceSet := false
+		forecastCmd.Visit(func(f *flag.Flag) { balanceSet = balanceSet || f.Name == "balance" })
+		if !balanceSet {
+			income, expense, err := store.GetBalance(ctx, tracker.DateRange{End: now.Format("2006-01-02")}, tracker.Filter{})
+			if err != nil {
+				fatal("", err)
+			}
+			balance = income - expense
+		}
+		forecast, err := tracker.ForecastBalance(ctx, store, now, balance, *forecastDays, *forecastHistory)
+		if err != nil {
+			fatal("", err)
+		}
+		printForecast(forecast, *forecastHistory)
+		if *forecastChart {
+			printForecastChart(forecast)
+		}
+	case "dedupe":
+		err := dedupeCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		opts := tracker.DuplicateOptions{Days: *dedupeDays, AmountTolerance: *dedupeTolerance, Similarity: *dedupeSimilarity}
+		groups, err := tracker.FindDuplicates(ctx, store, tracker.DateRange{Start: *dedupeStart, End: *dedupeEnd}, opts)
+		if err != nil {
+			fatal("", err)
+		}
+		if len(groups) == 0 {
+			fmt.Println("No duplicates found")
+			return
+		}
+		reviewDuplicates(ctx, groups, *dedupeList)
+	case "anomalies":
+		err := anomaliesCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		if *anomaliesDays <= 0 {
+			usageError("Number of days must be positive")
+		}
+		today := time.Now()
+		window := tracker.DateRange{
+			Start: today.AddDate(0, 0, 1-*anomaliesDays).Format("2006-01-02"),
+			End:   today.Format("2006-01-02"),
+		}
+		anomalies, err := tracker.FindAnomalies(ctx, store, tracker.AnomalyOptions{
+			Window:      window,
+			History:     *anomaliesHistory,
+			Sensitivity: *anomaliesSensitivity,
+		})
+		if err != nil {
+			fatal("", err)
+		}
+		printAnomalies(window, anomalies)
+	case "calendar":
+		err := calendarCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		where, err := tracker.ParseFilter(*calendarWhere)
+		if err != nil {
+			fatal("Invalid -where expression: ", err)
+		}
+		if *calendarThreshold < 0 {
+			usageError("Threshold cannot be negative")
+		}
+		r := tracker.YearRange(*calendarYear)
+		if *calendarMonth != "" {
+			if r, err = tracker.MonthRange(*calendarMonth); err != nil {
+				usageError(err.Error())
+			}
+		}
+		days, err := tracker.DailySpending(ctx, store, r, where)
+		if err != nil {
+			fatal("", err)
+		}
+		threshold := *calendarThreshold
+		if threshold == 0 {
+			threshold = tracker.DayThreshold(days)
+		}
+		if *calendarMonth != "" {
+			printMonthCalendar(r, days, threshold)
+		} else {
+			printHeatmap(*calendarYear, r, days, threshold)
+		}
+	case "budget":
+		if len(os.Args) > 2 && (os.Args[2] == "update" || os.Args[2] == "history") {
+			budgetSubcommand(ctx, os.Args[2], os.Args[3:])
+			return
+		}
+		err := budgetCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		if *budgetAdd {
+			if *budgetCategory == "" || *budgetAmount <= 0 {
+				usageError("Category and amount are required")
+			}
+			thresholds, err := tracker.ParseThresholds(*budgetAlerts)
+			if err != nil {
+				usageError(err.Error())
+			}
+			budget := tracker.Budget{
+				Category:    *budgetCategory,
+				Amount:      *budgetAmount,
+				Period:      *budgetPeriod,
+				Anchor:      *budgetAnchor,
+				StartDate:   *budgetStart,
+				EndDate:     *budgetEnd,
+				Rollover:    *budgetRollover,
+				RolloverCap: *budgetCap,
+				Thresholds:  thresholds,
+			}
+
+			if err = tracker.ValidateBudget(budget); err != nil {
+				fatal("Budget validation error: ", err)
+			}
+
+			if err = store.AddBudget(ctx, budget); err != nil {
+				fatal("", err)
+			}
+
+			fmt.Println("Budget added successfully!")
+		} else if *budgetList {
+			budgets, err := store.GetBudgets(ctx)
+			if err != nil {
+				fatal("", err)
+			}
+			printBudgets(budgets)
+		} else if *budgetRemove {
+			if *budgetCategory == "" {
+				usageError("Category is required")
+			}
+			if err = store.RemoveBudget(ctx, *budgetCategory); err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Budget for category '%s' removed\n", *budgetCategory)
+		} else {
+			budgetCmd.Usage()
+		}
+	case "trash":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: finance trash list|restore|empty [flags]")
+			os.Exit(1)
+		}
+		switch os.Args[2] {
+		case "list":
+			err := trashListCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			transactions, err := store.GetTransactions(ctx, tracker.TransactionFilter{Trashed: true, Limit: *trashListLimit})
+			if err != nil {
+				fatal("", err)
+			}
+			printTrash(transactions)
+		case "restore":
+			err := trashRestoreCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			if *trashRestoreID == 0 {
+				usageError("Error: Transaction ID is required")
+			}
+			if err = store.RestoreTransaction(ctx, *trashRestoreID); err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Transaction #%d restored\n", *trashRestoreID)
+		case "empty":
+			err := trashEmptyCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			olderThan, err := parseAge(*trashEmptyOlderThan)
+			if err != nil {
+				usageError(err.Error())
+			}
+			if !*trashEmptyYes && !confirm("Permanently remove trashed transactions? [y/N]: ") {
+				fmt.Println("Aborted")
+				return
+			}
+			removed, err := store.EmptyTrash(ctx, olderThan)
+			if err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("%d transaction(s) permanently removed\n", removed)
+		default:
+			fmt.Println("Usage: finance trash list|restore|empty [flags]")
+			os.Exit(1)
+		}
+	case "envelope":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: finance envelope show|move|history [flags]")
+			os.Exit(1)
+		}
+		switch os.Args[2] {
+		case "show":
+			err := envelopeShowCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			date := time.Now()
+			if *envelopeShowDate != "" {
+				if date, err = time.Parse("2006-01-02", *envelopeShowDate); err != nil {
+					usageError("Error: Invalid date format, use YYYY-MM-DD")
+				}
+			}
+			envelopes, err := tracker.Envelopes(ctx, store, date)
+			if err != nil {
+				fatal("", err)
+			}
+			printEnvelopes(envelopes)
+		case "move":
+			err := envelopeMoveCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			if *envelopeMoveFrom == "" || *envelopeMoveTo == "" || *envelopeMoveAmount <= 0 {
+				usageError("Error: -from, -to and a positive -amount are required")
+			}
+			move := tracker.BudgetMove{
+				Date:   *envelopeMoveDate,
+				From:   *envelopeMoveFrom,
+				To:     *envelopeMoveTo,
+				Amount: *envelopeMoveAmount,
+				Note:   *envelopeMoveNote,
+			}
+			if _, err = store.MoveMoney(ctx, move); err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Moved $%.2f from '%s' to '%s'\n", move.Amount, move.From, move.To)
+		case "history":
+			err := envelopeHistoryCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			moves, err := store.GetBudgetMoves(ctx, tracker.DateRange{Start: *envelopeHistoryStart, End: *envelopeHistoryEnd})
+			if err != nil {
+				fatal("", err)
+			}
+			printMoves(moves)
+		default:
+			fmt.Println("Usage: finance envelope show|move|history [flags]")
+			os.Exit(1)
+		}
+	case "goal":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: finance goal add|list|remove [flags]")
+			os.Exit(1)
+		}
+		switch os.Args[2] {
+		case "add":
+			err := goalAddCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			if *goalAddName == "" || *goalAddTarget <= 0 || *goalAddBy == "" {
+				usageError("Error: -name, a positive -target and -by are required")
+			}
+			goal := tracker.Goal{
+				Name:       *goalAddName,
+				Kind:       *goalAddKind,
+				Category:   *goalAddCategory,
+				Target:     *goalAddTarget,
+				TargetDate: *goalAddBy,
+				StartDate:  *goalAddStart,
+			}
+			if err = store.AddGoal(ctx, goal); err != nil {
+				fatal("", err)
+			}
+			fmt.Println("Goal added successfully!")
+		case "list":
+			goals, err := store.GetGoals(ctx)
+			if err != nil {
+				fatal("", err)
+			}
+			var statuses []tracker.GoalStatus
+			for _, g := range goals {
+				status, err := tracker.GoalProgress(ctx, store, g, time.Now())
+				if err != nil {
+					fatal("", err)
+				}
+				statuses = append(statuses, status)
+			}
+			printGoals(statuses)
+		case "remove":
+			err := goalRemoveCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			if *goalRemoveName == "" {
+				usageError("Error: -name is required")
+			}
+			if err = store.RemoveGoal(ctx, *goalRemoveName); err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Goal '%s' removed\n", *goalRemoveName)
+		default:
+			fmt.Println("Usage: finance goal add|list|remove [flags]")
+			os.Exit(1)
+		}
+	case "plan":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: finance plan show|assign [flags]")
+			os.Exit(1)
+		}
+		switch os.Args[2] {
+		case "show":
+			err := planShowCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			plan, err := tracker.MonthPlan(ctx, store, *planShowMonth)
+			if err != nil {
+				fatal("", err)
+			}
+			printPlan(plan)
+		case "assign":
+			err := planAssignCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			if *planAssignCategory == "" || *planAssignAmount < 0 {
+				usageError("Error: -category and -amount are required")
+			}
+			assignment := tracker.Assignment{Month: *planAssignMonth, Category: *planAssignCategory, Amount: *planAssignAmount}
+			if err = store.Assign(ctx, assignment); err != nil {
+				fatal("", err)
+			}
+			plan, err := tracker.MonthPlan(ctx, store, *planAssignMonth)
+			if err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Assigned $%.2f to '%s' in %s, $%.2f left to assign\n", assignment.Amount, assignment.Category, assignment.Month, plan.ToBeAssigned)
+		default:
+			fmt.Println("Usage: finance plan show|assign [flags]")
+			os.Exit(1)
+		}
+	case "alerts":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: finance alerts add|list|remove|test|check|history [flags]")
+			os.Exit(1)
+		}
+		switch os.Args[2] {
+		case "add":
+			err := alertsAddCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			id, err := store.AddNotifier(ctx, tracker.NotifierConfig{Kind: *alertsAddKind, Target: *alertsAddTarget, Server: *alertsAddServer})
+			if err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Notifier #%d added, try it with 'finance alerts test -id %d'\n", id, id)
+		case "list":
+			configs, err := store.GetNotifiers(ctx)
+			if err != nil {
+				fatal("", err)
+			}
+			printNotifiers(configs)
+		case "remove":
+			err := alertsRemoveCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			if *alertsRemoveID == 0 {
+				usageError("Error: Notifier ID is required")
+			}
+			if err = store.RemoveNotifier(ctx, *alertsRemoveID); err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Notifier #%d removed\n", *alertsRemoveID)
+		case "test":
+			err := alertsTestCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			configs, err := store.GetNotifiers(ctx)
+			if err != nil {
+				fatal("", err)
+			}
+			today := time.Now().Format("2006-01-02")
+			alert := tracker.Alert{Category: "test", Window: tracker.DateRange{Start: today, End: today}, Threshold: 100, Spent: 100, Limit: 100}
+			red, green, reset := "", "", ""
+			if isColorSupported() {
+				red, green, reset = colorRed, colorGreen, colorReset
+			}
+			failed, tested := false, 0
+			for _, c := range configs {
+				if *alertsTestID != 0 && c.ID != *alertsTestID {
+					continue
+				}
+				tested++
+				n, err := tracker.NewNotifier(c)
+				if err == nil {
+					err = n.Notify(ctx, alert)
+				}
+				if err != nil {
+					failed = true
+					fmt.Printf("%s#%d %s: %v%s\n", red, c.ID, c.Kind, err, reset)
+				} else {
+					fmt.Printf("%s#%d %s: sent%s\n", green, c.ID, c.Kind, reset)
+				}
+			}
+			if *alertsTestID != 0 && tested == 0 {
+				fatal("", fmt.Errorf("notifier #%d %w", *alertsTestID, tracker.ErrNotFound))
+			}
+			if tested == 0 {
+				fmt.Println("No notifiers configured, add one with 'finance alerts add'")
+			}
+			if failed {
+				os.Exit(1)
+			}
+		case "check":
+			budgets, err := store.GetBudgets(ctx)
+			if err != nil {
+				fatal("", err)
+			}
+			for _, b := range budgets {
+				checkAlerts(ctx, b.Category, time.Now())
+			}
+		case "history":
+			err := alertsHistoryCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			alerts, err := store.GetAlerts(ctx, *alertsHistoryLimit)
+			if err != nil {
+				fatal("", err)
+			}
+			printAlerts(alerts)
+		default:
+			fmt.Println("Usage: finance alerts add|list|remove|test|check|history [flags]")
+			os.Exit(1)
+		}
+	case "rules":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: finance rules add|list|remove|test|apply [flags]")
+			os.Exit(1)
+		}
+		switch os.Args[2] {
+		case "add":
+			err := rulesAddCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			rule := tracker.Rule{
+				Type:      *rulesAddType,
+				Pattern:   *rulesAddPattern,
+				Payee:     *rulesAddPayee,
+				MinAmount: *rulesAddMin,
+				MaxAmount: *rulesAddMax,
+				Category:  *rulesAddCategory,
+				Tags:      *rulesAddTags,
+				Rewrite:   *rulesAddRewrite,
+			}
+			id, err := store.AddRule(ctx, rule)
+			if err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Rule #%d added, preview it on existing transactions with 'finance rules apply'\n", id)
+		case "list":
+			rules, err := store.GetRules(ctx)
+			if err != nil {
+				fatal("", err)
+			}
+			printRules(rules)
+		case "remove":
+			err := rulesRemoveCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			if *rulesRemoveID == 0 {
+				usageError("Error: Rule ID is required")
+			}
+			if err = store.RemoveRule(ctx, *rulesRemoveID); err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("Rule #%d removed\n", *rulesRemoveID)
+		case "test":
+			err := rulesTestCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			rules, err := store.GetRules(ctx)
+			if err != nil {
+				fatal("", err)
+			}
+			t := tracker.Transaction{Type: *rulesTestType, Amount: *rulesTestAmount, Description: *rulesTestDesc}
+			after, id := tracker.ApplyRules(rules, t)
+			if id == 0 {
+				fmt.Println("No rule matches")
+				return
+			}
+			fmt.Printf("Rule #%d matches\n", id)
+			if after.Category != "" {
+				fmt.Printf("  Category:    %s\n", after.Category)
+			}
+			if after.Tags != "" {
+				fmt.Printf("  Tags:        %s\n", after.Tags)
+			}
+			if after.Description != t.Description {
+				fmt.Printf("  Description: %s -> %s\n", t.Description, after.Description)
+			}
+		case "apply":
+			err := rulesApplyCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Printf("Error: %s \n", err)
+				return
+			}
+			where, err := tracker.ParseFilter(*rulesApplyWhere)
+			if err != nil {
+				fatal("Invalid -where expression: ", err)
+			}
+			changes, err := tracker.PreviewRules(ctx, store, tracker.TransactionFilter{Where: where, SortBy: "date", Ascending: true})
+			if err != nil {
+				fatal("", err)
+			}
+			if len(changes) == 0 {
+				fmt.Println("The rules would change nothing")
+				return
+			}
+			printRuleChanges(changes)
+			if !*rulesApplyYes && !confirm(fmt.Sprintf("\nApply to %d transaction(s)? [y/N]: ", len(changes))) {
+				fmt.Println("Aborted")
+				return
+			}
+			n, err := tracker.ApplyRuleChanges(ctx, store, changes)
+			if err != nil {
+				fatal("", err)
+			}
+			fmt.Printf("%d transaction(s) updated\n", n)
+		default:
+			fmt.Println("Usage: finance rules add|list|remove|test|apply [flags]")
+			os.Exit(1)
+		}
+	case "backup":
+		err := backupCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		if *backupList {
+			backups, err := store.ListBackups()
+			if err != nil {
+				fatal("", err)
+			}
+			printBackups(backups)
+			return
+		}
+		path := *backupOutput
+		if path == "" {
+			path = store.DefaultBackupPath()
+		}
+		if err = store.Backup(ctx, path); err != nil {
+			fatal("Backup error: ", err)
+		}
+		fmt.Printf("Backup written to %s\n", path)
+	case "restore":
+		err := restoreCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		if restoreCmd.NArg() != 1 {
+			usageError("Usage: finance restore [-yes] <backup file>")
+		}
+		if !*restoreYes && !confirm(fmt.Sprintf("Replace the current database with %s? [y/N]: ", restoreCmd.Arg(0))) {
+			fmt.Println("Aborted")
+			return
+		}
+		safety, err := store.Restore(ctx, restoreCmd.Arg(0))
+		if err != nil {
+			fatal("Restore error: ", err)
+		}
+		fmt.Printf("Database restored from %s\n", restoreCmd.Arg(0))
+		fmt.Printf("Previous state saved to %s\n", safety)
+	case "encrypt":
+		passphrase, err := readPassphrase("New passphrase: ", true)
+		if err != nil {
+			fatal("", err)
+		}
+		if err = store.Encrypt(ctx, passphrase); err != nil {
+			fatal("Encryption error: ", err)
+		}
+		fmt.Println("Database encrypted. Unlock it with the passphrase or FINANCE_PASSPHRASE.")
+		plain, err := store.PlainBackups()
+		if err == nil && len(plain) > 0 {
+			yellow, reset := "", ""
+			if isColorSupported() {
+				yellow, reset = colorYellow, colorReset
+			}
+			fmt.Printf("%sWARNING: %d backup(s) in %s are not encrypted and should be deleted:%s\n",
+				yellow, len(plain), store.BackupDir(), reset)
+			for _, path := range plain {
+				fmt.Println("  " + path)
+			}
+		}
+	case "decrypt":
+		err := decryptCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		if !*decryptYes && !confirm("Store the database unencrypted? [y/N]: ") {
+			fmt.Println("Aborted")
+			return
+		}
+		if err = store.Decrypt(ctx); err != nil {
+			fatal("Decryption error: ", err)
+		}
+		fmt.Println("Database decrypted")
+	case "rekey":
+		passphrase, err := readPassphrase("New passphrase: ", true)
+		if err != nil {
+			fatal("", err)
+		}
+		if err = store.Rekey(ctx, passphrase); err != nil {
+			fatal("Rekey error: ", err)
+		}
+		fmt.Println("Passphrase changed. Older encrypted backups still need the previous passphrase.")
+	case "audit":
+		err := auditCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		for _, d := range []string{*auditStart, *auditEnd} {
+			if d == "" {
+				continue
+			}
+			if _, err = time.Parse("2006-01-02", d); err != nil {
+				usageError("Error: invalid date format, use YYYY-MM-DD")
+			}
+		}
+		entries, err := store.GetAuditLog(ctx, tracker.AuditFilter{
+			Entity:    *auditEntity,
+			EntityID:  *auditID,
+			User:      *auditUser,
+			StartDate: *auditStart,
+			EndDate:   *auditEnd,
+			Limit:     *auditLimit,
+		})
+		if err != nil {
+			fatal("", err)
+		}
+		printAudit(entries)
+	case "undo":
+		err := undoCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		entries, err := store.Undo(ctx, *undoCount)
+		if err != nil {
+			fatal("Undo error: ", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Nothing to undo")
+			return
+		}
+		for _, e := range entries {
+			fmt.Printf("Undone #%d: %s\n", e.ID, e.Command)
+		}
+	case "redo":
+		err := redoCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		entries, err := store.Redo(ctx, *redoCount)
+		if err != nil {
+			fatal("Redo error: ", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Nothing to redo")
+			return
+		}
+		for _, e := range entries {
+			fmt.Printf("Redone #%d: %s\n", e.ID, e.Command)
+		}
+	case "history":
+		err := historyCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %s \n", err)
+			return
+		}
+		if *historyID != 0 {
+			changes, err := store.GetJournalChanges(ctx, *historyID)
+			if err != nil {
+				fatal("", err)
+			}
+			printJournalChanges(changes)
+			return
+		}
+		entries, err := store.GetJournal(ctx, *historyLimit)
+		if err != nil {
+			fatal("", err)
+		}
+		printJournal(entries)
+	default:
+		printHelp()
+		os.Exit(1)
+	}
+}
+
+// budgetSubcommand runs "budget update" and "budget history", which work on
+// the limit history of one budget.
+func budgetSubcommand(ctx context.Context, name string, args []string) {
+	cmd := flag.NewFlagSet("budget "+name, flag.ExitOnError)
+	category := cmd.String("category", "", "Budget category")
+	amount := cmd.Float64("amount", 0, "New budget amount")
+	effective := cmd.String("effective", time.Now().Format("2006-01-02"), "Date the new amount applies from (YYYY-MM-DD); earlier periods keep their limit")
+	if err := cmd.Parse(args); err != nil {
+		fmt.Printf("Error: %s \n", err)
+		return
+	}
+	if *category == "" {
+		usageError("Category is required")
+	}
+
+	if name == "history" {
+		if _, err := store.GetBudget(ctx, *category); err != nil {
+			fatal("", err)
+		}
+		amounts, err := store.GetBudgetAmounts(ctx, *category)
+		if err != nil {
+			fatal("", err)
+		}
+		printBudgetAmounts(amounts)
+		return
+	}
+
+	if *amount <= 0 {
+		usageError("Category and amount are required")
+	}
+	if err := store.UpdateBudget(ctx, *category, *amount, *effective); err != nil {
+		fatal("", err)
+	}
+	fmt.Printf("Budget for category '%s' set to $%.2f from %s\n", *category, *amount, *effective)
+}
+
+func commandLine(args []string) string {
+	parts := []string{"finance"}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+type assignmentList []string
+
+func (a *assignmentList) String() string {
+	return strings.Join(*a, ", ")
+}
+
+func (a *assignmentList) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+func applyAssignments(t *tracker.Transaction, assignments []string) error {
+	for _, assignment := range assignments {
+		field, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return fmt.Errorf("%q is not in field=value form", assignment)
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "type":
+			t.Type = value
+		case "category":
+			t.Category = value
+		case "amount":
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil || amount <= 0 {
+				return fmt.Errorf("invalid amount %q, it must be positive", value)
+			}
+			t.Amount = amount
+		case "desc", "description":
+			t.Description = value
+		case "tags":
+			t.Tags = value
+		case "date":
+			t.Date = value
+		default:
+			return fmt.Errorf("unknown field %q, use type, category, amount, desc, tags or date", field)
+		}
+	}
+	return nil
+}
+
+// filterFlags are the flags that select transactions, shared by list and
+// the commands that change what it lists.
+type filterFlags struct {
+	typ, category, start, end, where *string
+	min, max                         *float64
+}
+
+func addFilterFlags(fs *flag.FlagSet) filterFlags {
+	return filterFlags{
+		typ:      fs.String("type", "", "Filter by type (income/expense)"),
+		category: fs.String("category", "", "Filter by category"),
+		start:    fs.String("start", "", "Start date (YYYY-MM-DD)"),
+		end:      fs.String("end", "", "End date (YYYY-MM-DD)"),
+		min:      fs.Float64("min", 0, "Minimum amount"),
+		max:      fs.Float64("max", 0, "Maximum amount"),
+		where:    fs.String("where", "", "Filter expression, e.g. 'amount > 100 and category in (food, shopping)'"),
+	}
+}
+
+func (f filterFlags) filter() tracker.TransactionFilter {
+	where, err := tracker.ParseFilter(*f.where)
+	if err != nil {
+		fatal("Invalid -where expression: ", err)
+	}
+	if *f.max > 0 && *f.max < *f.min {
+		usageError("Error: -max cannot be less than -min")
+	}
+	return tracker.TransactionFilter{
+		Type:      *f.typ,
+		Category:  *f.category,
+		StartDate: *f.start,
+		EndDate:   *f.end,
+		MinAmount: *f.min,
+		MaxAmount: *f.max,
+		Where:     where,
+	}
+}
+
+func filterIsEmpty(f tracker.TransactionFilter) bool {
+	return f.Type == "" && f.Category == "" && f.StartDate == "" && f.EndDate == "" &&
+		f.MinAmount == 0 && f.MaxAmount == 0 && f.Where.IsEmpty()
+}
+
+// previewBulk shows the transactions matching filter and, once confirmed,
+// returns them with the versions shown, so that the bulk operation fails
+// instead of touching any that changed in the meantime.
+func previewBulk(ctx context.Context, filter tracker.TransactionFilter, action string, skipConfirm bool) (map[int]int, bool) {
+	transactions, err := store.GetTransactions(ctx, filter)
+	if err != nil {
+		fatal("", err)
+	}
+	if len(transactions) == 0 {
+		fmt.Println("No transactions match the filter")
+		return nil, false
+	}
+	totals, err := store.GetTransactionTotals(ctx, filter)
+	if err != nil {
+		fatal("", err)
+	}
+
+	printTransactions(transactions, 0, totals)
+	if !skipConfirm && !confirm(fmt.Sprintf("\n%s %d transaction(s)? [y/N]: ", action, len(transactions))) {
+		fmt.Println("Aborted")
+		return nil, false
+	}
+
+	versions := make(map[int]int, len(transactions))
+	for _, t := range transactions {
+		versions[t.ID] = t.Version
+	}
+	return versions, true
+}
+
+// Exit codes, so scripts can tell why a command failed. Flag parsing
+// errors already exit with 2.
+const (
+	exitError      = 1
+	exitValidation = 2
+	exitNotFound   = 3
+	exitConflict   = 4
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, tracker.ErrValidation):
+		return exitValidation
+	case errors.Is(err, tracker.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, tracker.ErrConflict):
+		return exitConflict
+	default:
+		return exitError
+	}
+}
+
+func fatal(prefix string, err error) {
+	log.Print(prefix + err.Error())
+	os.Exit(exitCode(err))
+}
+
+func usageError(msg string) {
+	log.Print(msg)
+	os.Exit(exitValidation)
+}
+
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// parseAge accepts Go durations ("36h") as well as whole days ("30d").
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q, use e.g. 30d or 12h", s)
+	}
+	return d, nil
+}
+
+func printHelp() {
+	fmt.Println(`Personal Finance Tracker - Usage:
+    
+Commands:
+  add       - Add new transaction
+  list      - List transactions
+  export    - Write transactions to CSV or JSON
+  update    - Update transaction
+  delete    - Delete transaction
+  stats     - Show statistics
+  trends    - Compare totals month over month and year over year
+  forecast  - Project the balance from recurring and typical spending
+  rules     - Categorize transactions automatically by description and amount
+  dedupe    - Find duplicate transactions and merge or delete them
+  anomalies - Flag unusual, doubled or newly recurring expenses
+  calendar  - Show daily spending as a heatmap or a monthly calendar
+  budget    - Manage budgets
+  envelope  - Show envelopes, move money between them or list moves
+  goal      - Track savings goals and income targets
+  alerts    - Configure where budget alerts are sent
+  plan      - Assign each month's income to categories (zero-based budgeting)
+  trash     - List, restore or empty deleted transactions
+  reset     - Reset database
+  undo      - Undo the last operation(s)
+  redo      - Redo undone operation(s)
+  history   - Show the operation journal
+  audit     - Show who changed what and when
+  backup    - Back up the database or list backups
+  restore   - Restore the database from a backup
+  encrypt   - Encrypt the database with a passphrase
+  decrypt   - Store the database unencrypted again
+  rekey     - Change the encryption passphrase
+
+Examples:
+  finance add -type income -category salary -amount 2500 -date 2023-09-01
+  finance list -type expense
+  finance stats -period month
+  finance trends -by quarter -months 24
+  finance trends -months 12 -chart
+  finance forecast -days 90 -balance 1200
+  finance anomalies -days 60
+  finance dedupe -start 2026-01-01
+  finance rules add -pattern '(?i)^amzn mktp' -category shopping -rewrite Amazon
+  finance calendar -year 2026
+  finance calendar -month 2026-10 -threshold 150
+  finance budget update -category food -amount 900 -effective 2026-10-01
+  finance goal add -name vacation -target 3000 -by 2027-06-01 -category savings
+  finance plan assign -month 2026-10 -category rent -amount 1200
+  finance alerts add -kind webhook -target https://example.com/hook
+  finance envelope move -from fun -to groceries -amount 50
+  finance list -where 'amount > 100 and category in (food, shopping) and desc ~ "coffee"'
+  finance update -where 'date >= 2026-01-01 and category = groceries' -set category=food
+  finance delete -where 'desc ~ "test"' -yes
+  finance export -format json -where 'category in (food, shopping)' -o food.json
+  finance update -category groceries -start 2026-01-01 -end 2026-01-31 -set category=food
+
+Use 'finance [command] -h' for command-specific help`)
+}
+
+func printTransactions(transactions []tracker.Transaction, offset int, totals tracker.TransactionTotals) {
+	printTransactionTable(transactions)
+
+	fmt.Println(strings.Repeat("-", 75))
+	if len(transactions) == 0 {
+		fmt.Printf("No transactions shown (%d match the filter)\n", totals.Count)
+	} else {
+		fmt.Printf("Showing %d-%d of %d transactions\n", offset+1, offset+len(transactions), totals.Count)
+	}
+	net := totals.Income - totals.Expense
+	netSign := ""
+	if net < 0 {
+		netSign = "-"
+	}
+	fmt.Printf("Income: $%.2f  Expenses: $%.2f  Net: %s$%.2f\n",
+		totals.Income, totals.Expense, netSign, math.Abs(net))
+}
+
+func printTransactionTable(transactions []tracker.Transaction) {
+	fmt.Printf("%-4s %-4s %-10s %-15s %-10s %-20s %-10s\n",
+		"ID", "Ver", "Date", "Type", "Amount", "Category", "Description")
+	fmt.Println(strings.Repeat("-", 75))
+
+	for _, t := range transactions {
+		amountSign := ""
+		if t.Type == "expense" {
+			amountSign = "-"
+		}
+		description := t.Description
+		if t.Tags != "" {
+			description = strings.TrimSpace(description + " [" + t.Tags + "]")
+		}
+		fmt.Printf("%-4d %-4d %-10s %-15s %s%-9.2f %-20s %-10s\n",
+			t.ID,
+			t.Version,
+			t.Date,
+			t.Type,
+			amountSign,
+			t.Amount,
+			t.Category,
+			description)
+	}
+}
+
+func printStatistics(ctx context.Context, period tracker.DateRange, where tracker.Filter, income, expense float64, stats map[string]float64) {
+	balance := income - expense
+	useColor := isColorSupported()
+
+	reset, red, green, yellow, cyan, bold := "", "", "", "", "", ""
+	if useColor {
+		reset = "\033[0m"
+		red = "\033[31m"
+		green = "\033[32m"
+		yellow = "\033[33m"
+		cyan = "\033[36m"
+		bold = "\033[1m"
+	}
+
+	fmt.Printf("\n%s=== FINANCIAL STATISTICS ===%s\n", bold, reset)
+
+	fmt.Printf("\n%sTotal Income:%s  $%.2f\n", bold, reset, income)
+	fmt.Printf("%sTotal Expenses:%s $%.2f\n", bold, reset, expense)
+
+	budgets, err := store.GetBudgets(ctx)
+	if err == nil && len(budgets) > 0 {
+		fmt.Printf("\n%sBudget Status:%s\n", bold, reset)
+
+		for _, budget := range budgets {
+			// Without a start date stats covers all time, so only the
+			// current period is shown; otherwise every period in range is
+			// compared against the limit it had.
+			var statuses []tracker.BudgetStatus
+			if period.Start == "" {
+				status, err := tracker.EvaluateBudget(ctx, store, budget, time.Now())
+				if err != nil {
+					continue
+				}
+				statuses = append(statuses, status)
+			} else if statuses, err = tracker.BudgetHistory(ctx, store, budget, period); err != nil {
+				continue
+			}
+			if len(statuses) == 0 || !statuses[0].Active {
+				fmt.Printf(" - %s%-15s%s: inactive (%s)\n", cyan, budget.Category, reset,
+					formatWindow(tracker.DateRange{Start: budget.StartDate, End: budget.EndDate}))
+				continue
+			}
+
+			for _, status := range statuses {
+				percentage := status.Ratio() * 100
+				statusColor := green
+				if percentage > 90 {
+					statusColor = red
+				} else if percentage > 75 {
+					statusColor = yellow
+				}
+
+				fmt.Printf(" - %s%-15s%s: $%s%.2f%s / $%s%.2f%s (%s%.1f%%%s) %s\n",
+					cyan, budget.Category, reset,
+					statusColor, status.Spent, reset,
+					yellow, status.Limit, reset,
+					statusColor, percentage, reset,
+					formatWindow(status.Window))
+			}
+		}
+	}
+
+	printPlanWarnings(ctx, period, red, yellow, reset)
+
+	balanceColor := green
+	balanceSign := ""
+	if balance < 0 {
+		balanceColor = red
+		balanceSign = "-"
+	}
+	fmt.Printf("%sBalance:%s       %s$%s%.2f%s\n",
+		bold, reset, balanceColor, balanceSign, math.Abs(balance), reset)
+
+	if len(stats) > 0 {
+		fmt.Printf("\n%sExpenses by Category:%s\n", bold, reset)
+
+		type CategoryStat struct {
+			Name  string
+			Value float64
+		}
+
+		var sortedStats []CategoryStat
+		for category, amount := range stats {
+			sortedStats = append(sortedStats, CategoryStat{category, amount})
+		}
+
+		sort.Slice(sortedStats, func(i, j int) bool {
+			return sortedStats[i].Value > sortedStats[j].Value
+		})
+
+		totalExpense := expense
+		if totalExpense == 0 {
+			totalExpense = 1
+		}
+
+		// Sparklines show each category over the six months up to the
+		// end of the period.
+		end := time.Now()
+		if period.End != "" {
+			end, _ = time.Parse("2006-01-02", period.End)
+		}
+		history, err := tracker.Trends(ctx, store, "month", sparklineMonths, end, where)
+		if err != nil {
+			fatal("", err)
+		}
+		chart := detectChartStyle()
+
+		var labels []string
+		var values []float64
+		for _, stat := range sortedStats {
+			percentage := (stat.Value / totalExpense) * 100
+			var monthly []float64
+			for _, t := range history {
+				monthly = append(monthly, t.Bucket.Categories[stat.Name])
+			}
+			fmt.Printf(" - %s%-20s%s: $%s%.2f%s (%s%.1f%%%s) %s\n",
+				cyan, stat.Name, reset,
+				yellow, stat.Value, reset,
+				green, percentage, reset,
+				chart.sparkline(monthly))
+			labels = append(labels, stat.Name)
+			values = append(values, stat.Value)
+		}
+		if len(history) > 0 {
+			fmt.Printf("   (trend: %s to %s)\n", history[0].Bucket.Label, history[len(history)-1].Bucket.Label)
+		}
+		fmt.Println()
+		fmt.Print(chart.barChart(labels, values, colorCyan))
+
+		topCount := 3
+		if len(sortedStats) < 3 {
+			topCount = len(sortedStats)
+		}
+
+		if topCount > 0 {
+			fmt.Printf("\n%sTop %d Expenses:%s\n", bold, topCount, reset)
+			for i := 0; i < topCount; i++ {
+				fmt.Printf("%d. %s%s%s ($%s%.2f%s)\n",
+					i+1,
+					cyan, sortedStats[i].Name, reset,
+					yellow, sortedStats[i].Value, reset)
+			}
+		}
+	} else {
+		fmt.Printf("\n%sNo expense data available%s\n", yellow, reset)
+	}
+
+	if expense > 0 && income > 0 {
+		expenseRatio := expense / income
+		fmt.Printf("\n%sExpense/Income Ratio:%s ", bold, reset)
+		printProgressBar(expenseRatio)
+	}
+	fmt.Printf("%sExpense Categories:%s %d\n", bold, reset, len(stats))
+	fmt.Println()
+}
+
+func printProgressBar(ratio float64) {
+	const barWidth = 30
+	bar := detectChartStyle().bar(ratio, 1, barWidth)
+
+	fmt.Printf("[%s%s] %.1f%%\n", bar, strings.Repeat(" ", barWidth-utf8.RuneCountInString(bar)), ratio*100)
+}
+
+// sparklineMonths is how many months of history stats shows next to each
+// category.
+const sparklineMonths = 6
+
+// reviewDuplicates shows each group of duplicates and, unless listOnly,
+// asks whether to merge it, delete some of it or leave it alone.
+func reviewDuplicates(ctx context.Context, groups [][]tracker.Transaction, listOnly bool) {
+	merged, deleted := 0, 0
+	for i, group := range groups {
+		fmt.Printf("\nGroup %d of %d:\n", i+1, len(groups))
+		printTransactionTable(group)
+		if listOnly {
+			continue
+		}
+
+		ids := make([]int, len(group))
+		for j, t := range group {
+			ids[j] = t.ID
+		}
+	prompt:
+		for {
+			fmt.Printf("[m]erge into #%d, merge into another [ID], [d]elete IDs (e.g. d %d), [s]kip or [q]uit: ", ids[0], ids[len(ids)-1])
+			answer, err := stdin.ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if err != nil && answer == "" {
+				answer = "q"
+			}
+
+			keep := 0
+			switch {
+			case answer == "m":
+				keep = ids[0]
+			case answer == "s" || answer == "":
+				break prompt
+			case answer == "q":
+				fmt.Printf("\nMerged %d and deleted %d transaction(s)\n", merged, deleted)
+				return
+			case strings.HasPrefix(answer, "d"):
+				remove := make(map[int]int)
+				for _, field := range strings.FieldsFunc(answer[1:], func(r rune) bool { return r == ',' || r == ' ' }) {
+					id, err := strconv.Atoi(strings.TrimPrefix(field, "#"))
+					j := slices.Index(ids, id)
+					if err != nil || j < 0 {
+						clear(remove)
+						break
+					}
+					remove[id] = group[j].Version
+				}
+				if len(remove) == 0 {
+					fmt.Println("Give the IDs to delete from this group")
+					continue
+				}
+				n, err := store.BulkDeleteTransactions(ctx, remove)
+				if err != nil {
+					fatal("", err)
+				}
+				deleted += int(n)
+				fmt.Printf("Moved %d transaction(s) to the trash\n", n)
+				break prompt
+			default:
+				id, err := strconv.Atoi(strings.TrimPrefix(answer, "#"))
+				if err != nil || !slices.Contains(ids, id) {
+					fmt.Println("Unknown answer")
+					continue
+				}
+				keep = id
+			}
+
+			others := slices.DeleteFunc(slices.Clone(ids), func(id int) bool { return id == keep })
+			if err := store.MergeTransactions(ctx, keep, others); err != nil {
+				fatal("", err)
+			}
+			merged += len(others)
+			fmt.Printf("Kept #%d, moved %d duplicate(s) to the trash\n", keep, len(others))
+			break
+		}
+	}
+	if listOnly {
+		fmt.Printf("\n%d group(s) of duplicates\n", len(groups))
+		return
+	}
+	fmt.Printf("\nMerged %d and deleted %d transaction(s). Use 'finance undo' or 'finance trash restore' to bring them back.\n", merged, deleted)
+}
+
+func printRules(rules []tracker.Rule) {
+	if len(rules) == 0 {
+		fmt.Println("No rules, add one with 'finance rules add'")
+		return
+	}
+	fmt.Printf("%-4s %-8s %-24s %-16s %-17s %-14s %-16s %s\n", "ID", "Type", "Pattern", "Payee", "Amount", "Category", "Tags", "Rewrite")
+	fmt.Println(strings.Repeat("-", 117))
+	for _, r := range rules {
+		amount := ""
+		switch {
+		case r.MinAmount != 0 && r.MaxAmount != 0:
+			amount = fmt.Sprintf("%.2f-%.2f", r.MinAmount, r.MaxAmount)
+		case r.MinAmount != 0:
+			amount = fmt.Sprintf(">= %.2f", r.MinAmount)
+		case r.MaxAmount != 0:
+			amount = fmt.Sprintf("<= %.2f", r.MaxAmount)
+		}
+		fmt.Printf("%-4d %-8s %-24s %-16s %-17s %-14s %-16s %s\n", r.ID, r.Type, r.Pattern, r.Payee, amount, r.Category, r.Tags, r.Rewrite)
+	}
+	fmt.Println("\nThe first matching rule applies.")
+}
+
+func printRuleChanges(changes []tracker.RuleChange) {
+	fmt.Printf("%-4s %-10s %-10s %-5s %s\n", "ID", "Date", "Amount", "Rule", "Change")
+	fmt.Println(strings.Repeat("-", 75))
+	for _, c := range changes {
+		var parts []string
+		if c.Before.Category != c.After.Category {
+			parts = append(parts, fmt.Sprintf("category %s -> %s", c.Before.Category, c.After.Category))
+		}
+		if c.Before.Tags != c.After.Tags {
+			parts = append(parts, fmt.Sprintf("tags %q -> %q", c.Before.Tags, c.After.Tags))
+		}
+		if c.Before.Description != c.After.Description {
+			parts = append(parts, fmt.Sprintf("description %q -> %q", c.Before.Description, c.After.Description))
+		}
+		fmt.Printf("%-4d %-10s %-10.2f #%-4d %s\n", c.Before.ID, c.Before.Date, c.Before.Amount, c.RuleID, strings.Join(parts, ", "))
+	}
+}
+
+func printAnomalies(window tracker.DateRange, anomalies []tracker.Anomaly) {
+	if len(anomalies) == 0 {
+		fmt.Printf("No unusual expenses between %s and %s\n", window.Start, window.End)
+		return
+	}
+	useColor := isColorSupported()
+	colors := map[string]string{
+		tracker.AnomalyOutlier:   colorRed,
+		tracker.AnomalyDuplicate: colorYellow,
+		tracker.AnomalyRecurring: colorCyan,
+	}
+
+	fmt.Printf("\nUnusual expenses between %s and %s:\n", window.Start, window.End)
+	fmt.Printf("%-4s %-10s %-10s %-20s %-10s\n", "ID", "Date", "Amount", "Category", "Description")
+	fmt.Println(strings.Repeat("-", 75))
+	for i, a := range anomalies {
+		t := a.Transaction
+		if i == 0 || anomalies[i-1].Transaction.ID != t.ID {
+			fmt.Printf("%-4d %-10s -%-9.2f %-20s %-10s\n", t.ID, t.Date, t.Amount, t.Category, t.Description)
+		}
+		kind, reset := a.Kind, ""
+		if useColor {
+			kind, reset = colors[a.Kind]+a.Kind, colorReset
+		}
+		fmt.Printf("     %s%s: %s\n", kind, reset, a.Reason)
+	}
+	fmt.Printf("\n%d flagged\n", len(anomalies))
+}
+
+func printForecast(f tracker.Forecast, history int) {
+	red, green, bold, reset := "", "", "", ""
+	if isColorSupported() {
+		red, green, bold, reset = colorRed, colorGreen, colorBold, colorReset
+	}
+	// money pads before colouring so that columns stay aligned.
+	money := func(v float64, width int) string {
+		if v < 0 {
+			return fmt.Sprintf("%s%*.2f%s", red, width, v, reset)
+		}
+		return fmt.Sprintf("%*.2f", width, v)
+	}
+
+	fmt.Printf("\n%sCash-flow forecast for %d days%s\n", bold, len(f.Days), reset)
+	fmt.Printf("Starting balance: $%s\n", money(f.Balance, 0))
+
+	if len(f.Recurring) > 0 {
+		fmt.Println("\nRecurring:")
+		for _, r := range f.Recurring {
+			amount := fmt.Sprintf("%s+%.2f%s", green, r.Amount, reset)
+			if r.Type == "expense" {
+				amount = fmt.Sprintf("-%.2f", r.Amount)
+			}
+			name := r.Category
+			if r.Description != "" {
+				name += " (" + r.Description + ")"
+			}
+			fmt.Printf(" - %-30s %s %-9s next %s\n", name, amount, r.Interval, r.Next)
+		}
+	}
+
+	var categories []string
+	perDay := 0.0
+	for category, amount := range f.Discretionary {
+		categories = append(categories, category)
+		perDay += amount
+	}
+	if len(categories) > 0 {
+		sort.Slice(categories, func(i, j int) bool { return f.Discretionary[categories[i]] > f.Discretionary[categories[j]] })
+		fmt.Printf("\nOther spending, averaged over the last %d days: $%.2f a day\n", history, perDay)
+		for _, category := range categories {
+			fmt.Printf(" - %-30s %.2f/day\n", category, f.Discretionary[category])
+		}
+	}
+
+	fmt.Printf("\n%-12s %12s %25s\n", "Date", "Balance", "90% range")
+	for i, day := range f.Days {
+		if i%7 != 6 && i != len(f.Days)-1 {
+			continue
+		}
+		fmt.Printf("%-12s %s %s to %s\n", day.Date, money(day.Balance, 12), money(day.Low, 12), money(day.High, 10))
+	}
+
+	lowest := f.Lowest
+	fmt.Printf("\nLowest projected balance: $%s on %s (90%% range $%.2f to $%.2f)\n", money(lowest.Balance, 0), lowest.Date, lowest.Low, lowest.High)
+	if f.NextPayday != "" {
+		fmt.Printf("Next payday: %s\n", f.NextPayday)
+	}
+	for _, day := range f.Days {
+		if day.Balance < 0 {
+			note := ""
+			if f.NextPayday != "" && day.Date < f.NextPayday {
+				note = ", before the next payday"
+			}
+			fmt.Printf("%sThe balance is projected to go negative on %s%s.%s\n", red, day.Date, note, reset)
+			return
+		}
+	}
+	for _, day := range f.Days {
+		if day.Low < 0 {
+			fmt.Printf("%sThe balance may go negative from %s.%s\n", red, day.Date, reset)
+			return
+		}
+	}
+	fmt.Printf("%sThe balance stays positive.%s\n", green, reset)
+}
+
+func printForecastChart(f tracker.Forecast) {
+	var labels []string
+	balance := chartSeries{name: "Balance", color: colorCyan}
+	low := chartSeries{name: "Low", color: colorRed}
+	high := chartSeries{name: "High", color: colorGreen}
+	for i, day := range f.Days {
+		if i%7 != 6 && i != len(f.Days)-1 {
+			continue
+		}
+		labels = append(labels, day.Date[5:])
+		balance.values = append(balance.values, day.Balance)
+		low.values = append(low.values, day.Low)
+		high.values = append(high.values, day.High)
+	}
+	fmt.Println()
+	fmt.Print(detectChartStyle().lineChart(labels, []chartSeries{high, balance, low}, 12))
+}
+
+// heatLevels is how many shades the heatmap uses for days with spending.
+const heatLevels = 4
+
+// heatLevel buckets amount relative to the busiest day: 0 for no
+// spending, otherwise 1 to heatLevels.
+func heatLevel(amount, max float64) int {
+	if amount <= 0 || max <= 0 {
+		return 0
+	}
+	return min(int(math.Ceil(amount/max*heatLevels)), heatLevels)
+}
+
+func printHeatmap(year int, r tracker.DateRange, days map[string]float64, threshold float64) {
+	chart := detectChartStyle()
+	palette := []string{"", colorGreen, colorYellow, colorRed, colorBold + colorRed}
+	cells := []string{"·", "░", "▒", "▓", "█"}
+	if chart.color {
+		cells = []string{"·", "■", "■", "■", "■"}
+	}
+	if !chart.unicode {
+		cells = []string{".", "-", "+", "*", "#"}
+		if chart.color {
+			cells = []string{".", "#", "#", "#", "#"}
+		}
+	}
+	cell := func(level int) string {
+		if chart.color && palette[level] != "" {
+			return palette[level] + cells[level] + colorReset
+		}
+		return cells[level]
+	}
+
+	maxDay, total, over := 0.0, 0.0, 0
+	for _, amount := range days {
+		maxDay = math.Max(maxDay, amount)
+		total += amount
+		if amount > threshold {
+			over++
+		}
+	}
+
+	// Columns are weeks from Monday to Sunday, starting with the week of
+	// January 1st.
+	start, _ := time.Parse("2006-01-02", r.Start)
+	end, _ := time.Parse("2006-01-02", r.End)
+	first := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	weeks := int(end.Sub(first).Hours()/24)/7 + 1
+	width := 2
+	if 4+weeks*width > chart.width {
+		width = 1
+	}
+
+	fmt.Printf("\nDaily spending in %d\n", year)
+	header := []rune(strings.Repeat(" ", 4+weeks*width+3))
+	for m := time.January; m <= time.December; m++ {
+		day := time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+		col := 4 + int(day.Sub(first).Hours()/24)/7*width
+		copy(header[col:], []rune(day.Format("Jan")))
+	}
+	fmt.Println(strings.TrimRight(string(header), " "))
+
+	for weekday := 0; weekday < 7; weekday++ {
+		label := ""
+		if weekday%2 == 0 {
+			label = first.AddDate(0, 0, weekday).Format("Mon")
+		}
+		row := fmt.Sprintf("%-3s ", label)
+		for w := 0; w < weeks; w++ {
+			day := first.AddDate(0, 0, w*7+weekday)
+			text := " "
+			if !day.Before(start) && !day.After(end) {
+				text = cell(heatLevel(days[day.Format("2006-01-02")], maxDay))
+			}
+			row += text + strings.Repeat(" ", width-1)
+		}
+		fmt.Println(strings.TrimRight(row, " "))
+	}
+
+	fmt.Print("\n    Less ")
+	for level := 0; level <= heatLevels; level++ {
+		fmt.Print(cell(level) + " ")
+	}
+	fmt.Printf("More (darkest: up to $%.2f a day)\n", maxDay)
+	fmt.Printf("Total: $%.2f over %d days, %d over $%.2f\n", total, len(days), over, threshold)
+}
+
+// printMonthCalendar shows the days of a month, Monday first, each with
+// what was spent on it. Days over threshold are marked with "!".
+func printMonthCalendar(r tracker.DateRange, days map[string]float64, threshold float64) {
+	red, bold, reset := "", "", ""
+	if isColorSupported() {
+		red, bold, reset = colorRed, colorBold, colorReset
+	}
+	const cellWidth = 10
+
+	start, _ := time.Parse("2006-01-02", r.Start)
+	end, _ := time.Parse("2006-01-02", r.End)
+	title := start.Format("January 2006")
+	fmt.Printf("\n%s%*s%s\n", bold, (7*cellWidth+len(title))/2, title, reset)
+	fmt.Println(strings.Join([]string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}, strings.Repeat(" ", cellWidth-3)))
+
+	var over []string
+	total := 0.0
+	first := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	for week := first; !week.After(end); week = week.AddDate(0, 0, 7) {
+		var numbers, amounts strings.Builder
+		for i := 0; i < 7; i++ {
+			day := week.AddDate(0, 0, i)
+			if day.Before(start) || day.After(end) {
+				fmt.Fprintf(&numbers, "%-*s", cellWidth, "")
+				fmt.Fprintf(&amounts, "%-*s", cellWidth, "")
+				continue
+			}
+			fmt.Fprintf(&numbers, "%-*d", cellWidth, day.Day())
+			amount, ok := days[day.Format("2006-01-02")]
+			switch {
+			case !ok:
+				fmt.Fprintf(&amounts, "%-*s", cellWidth, "-")
+			case amount > threshold:
+				fmt.Fprintf(&amounts, "%s%-*s%s", red, cellWidth, fmt.Sprintf("%.2f!", amount), reset)
+				over = append(over, day.Format("2006-01-02"))
+			default:
+				fmt.Fprintf(&amounts, "%-*.2f", cellWidth, amount)
+			}
+			total += amount
+		}
+		fmt.Println(strings.TrimRight(numbers.String(), " "))
+		fmt.Println(strings.TrimRight(amounts.String(), " "))
+	}
+
+	fmt.Printf("\nTotal: $%.2f, %d days with spending\n", total, len(days))
+	if len(over) > 0 {
+		fmt.Printf("%sDays over $%.2f (!):%s\n", red, threshold, reset)
+		for _, date := range over {
+			fmt.Printf(" - %s: $%.2f\n", date, days[date])
+		}
+	}
+}
+
+func printTrendsChart(trends []tracker.Trend) {
+	var labels []string
+	income := chartSeries{name: "Income", color: colorGreen}
+	expense := chartSeries{name: "Expense", color: colorRed}
+	for _, t := range trends {
+		labels = append(labels, t.Bucket.Label)
+		income.values = append(income.values, t.Bucket.Income)
+		expense.values = append(expense.values, t.Bucket.Expense)
+	}
+	fmt.Print(detectChartStyle().lineChart(labels, []chartSeries{income, expense}, 12))
+	fmt.Println()
+}
+func isColorSupported() bool {
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor {
+		return false
+	}
+
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	if fileInfo, _ := os.Stdout.Stat(); (fileInfo.Mode() & os.ModeCharDevice) != 0 {
+		return true
+	}
+
+	return false
+}
+
+func formatWindow(r tracker.DateRange) string {
+	start, end := r.Start, r.End
+	if start == "" {
+		start = "..."
+	}
+	if end == "" {
+		end = "..."
+	}
+	return start + " - " + end
+}
+
+func printBudgets(budgets []tracker.Budget) {
+	useColor := isColorSupported()
+	reset, bold := "", ""
+	if useColor {
+		reset = colorReset
+		bold = colorBold
+	}
+
+	fmt.Printf("\n%s=== BUDGETS ===%s\n", bold, reset)
+	fmt.Printf("%-4s %-15s %-10s %-10s %-12s %-12s %-12s %-14s %-10s\n", "ID", "Category", "Amount", "Period", "Anchor", "Start", "End", "Rollover", "Alerts")
+	fmt.Println(strings.Repeat("-", 105))
+
+	for _, b := range budgets {
+		rollover := b.Rollover
+		if rollover == tracker.RolloverCapped {
+			rollover = fmt.Sprintf("capped $%.2f", b.RolloverCap)
+		}
+		thresholds := b.Thresholds
+		if len(thresholds) == 0 {
+			thresholds = tracker.DefaultThresholds
+		}
+		fmt.Printf("%-4d %-15s $%-9.2f %-10s %-12s %-12s %-12s %-14s %-10s\n",
+			b.ID,
+			b.Category,
+			b.Amount,
+			b.Period,
+			b.Anchor,
+			b.StartDate,
+			b.EndDate,
+			rollover,
+			tracker.FormatThresholds(thresholds)+"%")
+	}
+}
+
+func printBudgetAmounts(amounts []tracker.BudgetAmount) {
+	fmt.Printf("%-12s %10s\n", "From", "Amount")
+	fmt.Println(strings.Repeat("-", 23))
+	for _, a := range amounts {
+		from := a.EffectiveFrom
+		if from == "" {
+			from = "start"
+		}
+		fmt.Printf("%-12s %10.2f\n", from, a.Amount)
+	}
+}
+
+func printGoals(statuses []tracker.GoalStatus) {
+	useColor := isColorSupported()
+	reset, bold, cyan, green := "", "", "", ""
+	if useColor {
+		reset = colorReset
+		bold = colorBold
+		cyan = colorCyan
+		green = colorGreen
+	}
+
+	fmt.Printf("\n%s=== GOALS ===%s\n", bold, reset)
+	for _, st := range statuses {
+		g := st.Goal
+		linked := "balance"
+		if g.Category != "" {
+			linked = g.Category
+		} else if g.Kind == tracker.GoalIncome {
+			linked = "all income"
+		}
+		fmt.Printf("\n%s%s%s (%s, %s) by %s\n", cyan, g.Name, reset, g.Kind, linked, g.TargetDate)
+		fmt.Printf("  $%.2f / $%.2f ", st.Saved, g.Target)
+		printProgressBar(st.Ratio())
+		if st.Remaining == 0 {
+			fmt.Printf("  %sReached!%s\n", green, reset)
+			continue
+		}
+		fmt.Printf("  Needed:    $%.2f/month to reach it by %s\n", st.MonthlyNeeded, g.TargetDate)
+		fmt.Printf("  Recent:    $%.2f/month\n", st.MonthlyRate)
+		if st.Projected != "" {
+			fmt.Printf("  Projected: %s\n", st.Projected)
+		} else {
+			fmt.Println("  Projected: never at the recent rate")
+		}
+	}
+	if len(statuses) == 0 {
+		fmt.Println("No goals")
+	}
+}
+
+// printPlanWarnings warns about zero-based months in the stats period, or
+// the current month when the period is open, that are not fully assigned.
+func printPlanWarnings(ctx context.Context, period tracker.DateRange, red, yellow, reset string) {
+	month, last := time.Now().Format("2006-01"), time.Now().Format("2006-01")
+	if period.Start != "" {
+		start, _ := time.Parse("2006-01-02", period.Start)
+		end, _ := time.Parse("2006-01-02", period.End)
+		month, last = start.Format("2006-01"), end.Format("2006-01")
+	}
+
+	for month <= last {
+		plan, err := tracker.MonthPlan(ctx, store, month)
+		if err == nil && plan.Planned() {
+			if plan.ToBeAssigned > 0.005 {
+				fmt.Printf("%sWARNING: %s is under-assigned, $%.2f of income still to be assigned%s\n", yellow, month, plan.ToBeAssigned, reset)
+			} else if plan.ToBeAssigned < -0.005 {
+				fmt.Printf("%sWARNING: %s is over-assigned by $%.2f%s\n", red, month, -plan.ToBeAssigned, reset)
+			}
+		}
+		next, _ := time.Parse("2006-01", month)
+		month = next.AddDate(0, 1, 0).Format("2006-01")
+	}
+}
+
+func printPlan(plan tracker.Plan) {
+	useColor := isColorSupported()
+	reset, bold, red, green, yellow := "", "", "", "", ""
+	if useColor {
+		reset = colorReset
+		bold = colorBold
+		red = colorRed
+		green = colorGreen
+		yellow = colorYellow
+	}
+
+	fmt.Printf("\n%s=== PLAN %s ===%s\n", bold, plan.Month, reset)
+	fmt.Printf("%-20s %10s %10s %10s\n", "Category", "Assigned", "Spent", "Left")
+	fmt.Println(strings.Repeat("-", 53))
+	for _, a := range plan.Assignments {
+		left := a.Amount - plan.Spent[a.Category]
+		color := ""
+		if left < 0 {
+			color = red
+		}
+		fmt.Printf("%-20s %10.2f %10.2f %s%10.2f%s\n", a.Category, a.Amount, plan.Spent[a.Category], color, left, reset)
+	}
+	fmt.Println(strings.Repeat("-", 53))
+	fmt.Printf("%-20s %10.2f\n", "Income", plan.Income)
+	fmt.Printf("%-20s %10.2f\n", "Assigned", plan.Assigned)
+
+	color := green
+	if plan.ToBeAssigned > 0.005 {
+		color = yellow
+	} else if plan.ToBeAssigned < -0.005 {
+		color = red
+	}
+	fmt.Printf("%s%-20s %10.2f%s\n", color, "To be assigned", plan.ToBeAssigned, reset)
+}
+
+// consoleNotifier prints alerts as the coloured warning lines add has
+// always shown.
+type consoleNotifier struct{}
+
+func (consoleNotifier) Notify(ctx context.Context, a tracker.Alert) error {
+	color, reset := "", ""
+	if isColorSupported() {
+		color, reset = colorYellow, colorReset
+		if a.Threshold >= 100 {
+			color = colorRed
+		}
+	}
+	fmt.Printf("%sWARNING: %s in %s (%.1f%% of $%.2f)%s\n",
+		color, a.Title(), formatWindow(a.Window), a.Spent/a.Limit*100, a.Limit, reset)
+	return nil
+}
+
+// checkAlerts sends the alerts category has due on date to the console and
+// every configured notifier. Failed notifications are reported but do not
+// fail the command that triggered them.
+func checkAlerts(ctx context.Context, category string, date time.Time) {
+	notifiers := []tracker.Notifier{consoleNotifier{}}
+	configs, err := store.GetNotifiers(ctx)
+	if err != nil {
+		log.Print("Loading notifiers failed: ", err)
+	}
+	for _, c := range configs {
+		n, err := tracker.NewNotifier(c)
+		if err != nil {
+			log.Printf("Notifier #%d: %v", c.ID, err)
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	if _, err = tracker.CheckAlerts(ctx, store, category, date, notifiers); err != nil {
+		log.Print("Sending budget alert failed: ", err)
+	}
+}
+
+func printNotifiers(configs []tracker.NotifierConfig) {
+	fmt.Printf("%-4s %-8s %-40s %s\n", "ID", "Kind", "Target", "Server")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, c := range configs {
+		fmt.Printf("%-4d %-8s %-40s %s\n", c.ID, c.Kind, c.Target, c.Server)
+	}
+	if len(configs) == 0 {
+		fmt.Println("No notifiers configured, alerts are only printed")
+	}
+}
+
+func printAlerts(alerts []tracker.Alert) {
+	fmt.Printf("%-19s %-15s %-23s %9s %10s %10s\n", "Sent", "Category", "Period", "Threshold", "Spent", "Limit")
+	fmt.Println(strings.Repeat("-", 92))
+	for _, a := range alerts {
+		fmt.Printf("%-19s %-15s %-23s %8g%% %10.2f %10.2f\n", a.SentAt, a.Category, formatWindow(a.Window), a.Threshold, a.Spent, a.Limit)
+	}
+	if len(alerts) == 0 {
+		fmt.Println("No alerts sent yet")
+	}
+}
+
+func printTrends(by string, trends []tracker.Trend, top int) {
+	useColor := isColorSupported()
+	reset, bold, red, green, cyan := "", "", "", "", ""
+	if useColor {
+		reset = colorReset
+		bold = colorBold
+		red = colorRed
+		green = colorGreen
+		cyan = colorCyan
+	}
+
+	// formatChange colours a change green when it is good news: more
+	// income or net, less spending.
+	formatChange := func(c tracker.Change, moreIsBetter bool) string {
+		text := fmt.Sprintf("%+.2f (new)", c.Abs)
+		if !math.IsNaN(c.Percent) {
+			text = fmt.Sprintf("%+.2f (%+.1f%%)", c.Abs, c.Percent)
+		}
+		color := ""
+		if c.Abs != 0 && (c.Abs > 0) == moreIsBetter {
+			color = green
+		} else if c.Abs != 0 {
+			color = red
+		}
+		return fmt.Sprintf("%s%-22s%s", color, text, reset)
+	}
+	// A year's previous bucket already is the same bucket last year.
+	vsLastYear := func(c tracker.Change, moreIsBetter bool) string {
+		if by == "year" {
+			return ""
+		}
+		return formatChange(c, moreIsBetter)
+	}
+
+	fmt.Printf("\n%s=== TRENDS BY %s ===%s\n", bold, strings.ToUpper(by), reset)
+	for _, t := range trends {
+		b := t.Bucket
+		fmt.Printf("\n%s%s%s (%s)\n", cyan, b.Label, reset, formatWindow(b.Range))
+		lastYear := "vs " + t.LastYear.Label
+		if by == "year" {
+			lastYear = ""
+		}
+		fmt.Printf("  %-18s %12s   %-22s %-22s\n", "", "Amount", "vs "+t.Previous.Label, lastYear)
+		rows := []struct {
+			name         string
+			prev, now    float64
+			lastYear     float64
+			moreIsBetter bool
+		}{
+			{"Income", t.Previous.Income, b.Income, t.LastYear.Income, true},
+			{"Expense", t.Previous.Expense, b.Expense, t.LastYear.Expense, false},
+			{"Net", t.Previous.Net(), b.Net(), t.LastYear.Net(), true},
+		}
+		for _, r := range rows {
+			fmt.Printf("  %s%-18s%s %12.2f   %s %s\n", bold, r.name, reset, r.now,
+				formatChange(tracker.NewChange(r.prev, r.now), r.moreIsBetter),
+				vsLastYear(tracker.NewChange(r.lastYear, r.now), r.moreIsBetter))
+		}
+
+		changes := tracker.CategoryChanges(t.Previous, b)
+		sort.Slice(changes, func(i, j int) bool { return changes[i].To > changes[j].To })
+		for _, c := range changes {
+			if c.To == 0 {
+				continue
+			}
+			fmt.Printf("  %-18s %12.2f   %s %s\n", c.Category, c.To,
+				formatChange(c.Change, false),
+				vsLastYear(tracker.NewChange(t.LastYear.Categories[c.Category], c.To), false))
+		}
+
+		var grew []string
+		for _, c := range tracker.CategoryChanges(t.Previous, b) {
+			if len(grew) == top || c.Abs <= 0 {
+				break
+			}
+			grew = append(grew, fmt.Sprintf("%s %+.2f", c.Category, c.Abs))
+		}
+		if len(grew) > 0 {
+			fmt.Printf("  %sGrew most:%s %s\n", bold, reset, strings.Join(grew, ", "))
+		}
+	}
+	fmt.Println()
+}
+
+func printEnvelopes(envelopes []tracker.Envelope) {
+	useColor := isColorSupported()
+	reset, bold, red := "", "", ""
+	if useColor {
+		reset = colorReset
+		bold = colorBold
+		red = colorRed
+	}
+
+	fmt.Printf("\n%s=== ENVELOPES ===%s\n", bold, reset)
+	fmt.Printf("%-15s %-23s %10s %10s %10s %10s %10s\n", "Category", "Period", "Assigned", "Carried", "Moved", "Spent", "Available")
+	fmt.Println(strings.Repeat("-", 93))
+
+	for _, e := range envelopes {
+		color := ""
+		if e.Available < 0 {
+			color = red
+		}
+		fmt.Printf("%-15s %-23s %10.2f %10.2f %10.2f %10.2f %s%10.2f%s\n",
+			e.Category, formatWindow(e.Window), e.Assigned, e.Carried, e.Moved, e.Spent, color, e.Available, reset)
+	}
+	if len(envelopes) == 0 {
+		fmt.Println("No active budgets")
+	}
+}
+
+func printMoves(moves []tracker.BudgetMove) {
+	fmt.Printf("%-4s %-10s %-15s %-15s %10s  %s\n", "ID", "Date", "From", "To", "Amount", "Note")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, m := range moves {
+		fmt.Printf("%-4d %-10s %-15s %-15s %10.2f  %s\n", m.ID, m.Date, m.From, m.To, m.Amount, m.Note)
+	}
+	if len(moves) == 0 {
+		fmt.Println("No money moved between envelopes")
+	}
+}
+
+func printTrash(transactions []tracker.Transaction) {
+	fmt.Printf("%-4s %-19s %-10s %-8s %-10s %-20s %-10s\n",
+		"ID", "Deleted", "Date", "Type", "Amount", "Category", "Description")
+	fmt.Println(strings.Repeat("-", 90))
+
+	for _, t := range transactions {
+		fmt.Printf("%-4d %-19s %-10s %-8s %-10.2f %-20s %-10s\n",
+			t.ID, t.DeletedAt, t.Date, t.Type, t.Amount, t.Category, t.Description)
+	}
+	if len(transactions) == 0 {
+		fmt.Println("Trash is empty")
+	}
+}
+
+func printBackups(backups []tracker.BackupInfo) {
+	fmt.Printf("%-45s %-19s %10s\n", "Backup", "Created", "Size")
+	fmt.Println(strings.Repeat("-", 76))
+	for _, b := range backups {
+		fmt.Printf("%-45s %-19s %9.1fK\n", b.Name, b.ModTime.Format("2006-01-02 15:04:05"), float64(b.Size)/1024)
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups found")
+	}
+}
+
+func printAudit(entries []tracker.AuditEntry) {
+	useColor := isColorSupported()
+	reset, bold, cyan := "", "", ""
+	if useColor {
+		reset = colorReset
+		bold = colorBold
+		cyan = colorCyan
+	}
+
+	fmt.Printf("\n%s=== AUDIT LOG ===%s\n", bold, reset)
+	for _, e := range entries {
+		target := e.Entity
+		if e.EntityID != 0 {
+			target = fmt.Sprintf("%s #%d", e.Entity, e.EntityID)
+		}
+		fmt.Printf("%s %s%s@%s%s %s %s\n", e.CreatedAt, cyan, e.User, e.Host, reset, e.Action, target)
+		fmt.Printf("    %s\n", e.Command)
+		for _, name := range sortedFieldNames(e.Changes) {
+			c := e.Changes[name]
+			fmt.Printf("    %-12s %v -> %v\n", name+":", formatAuditValue(c.From), formatAuditValue(c.To))
+		}
+	}
+	if len(entries) == 0 {
+		fmt.Println("No audit records found")
+	}
+}
+
+func sortedFieldNames(changes map[string]tracker.FieldChange) []string {
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatAuditValue(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
+
+func printJournal(entries []tracker.JournalEntry) {
+	useColor := isColorSupported()
+	reset, bold, yellow := "", "", ""
+	if useColor {
+		reset = colorReset
+		bold = colorBold
+		yellow = colorYellow
+	}
+
+	fmt.Printf("\n%s=== HISTORY ===%s\n", bold, reset)
+	fmt.Printf("%-5s %-19s %-18s %s\n", "ID", "When", "Changes", "Command")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, e := range entries {
+		changes := fmt.Sprintf("+%d ~%d -%d", e.Added, e.Updated, e.Deleted)
+		status := ""
+		if e.Undone {
+			status = fmt.Sprintf(" %s(undone)%s", yellow, reset)
+		}
+		fmt.Printf("%-5d %-19s %-18s %s%s\n", e.ID, e.CreatedAt, changes, e.Command, status)
+	}
+}
+
+func printJournalChanges(changes []tracker.JournalChange) {
+	if len(changes) == 0 {
+		fmt.Println("No changes recorded for this operation")
+		return
+	}
+	for _, c := range changes {
+		action := "updated"
+		if c.Before == "" {
+			action = "added"
+		} else if c.After == "" {
+			action = "deleted"
+		}
+		fmt.Printf("%s #%d %s\n", c.Table, c.RowID, action)
+		if c.Before != "" {
+			fmt.Printf("  before: %s\n", c.Before)
+		}
+		if c.After != "" {
+			fmt.Printf("  after:  %s\n", c.After)
+		}
+	}
+}
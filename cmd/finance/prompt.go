@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// stdin is shared by every prompt so piped answers are not lost to
+// read-ahead buffering.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassphrase takes the passphrase from FINANCE_PASSPHRASE (or
+// FINANCE_NEW_PASSPHRASE when a new one is being chosen) or prompts for it,
+// asking twice for new passphrases.
+func readPassphrase(prompt string, confirmNew bool) (string, error) {
+	env := "FINANCE_PASSPHRASE"
+	if confirmNew {
+		env = "FINANCE_NEW_PASSPHRASE"
+	}
+	if pass, ok := os.LookupEnv(env); ok && pass != "" {
+		return pass, nil
+	}
+
+	pass, err := promptSecret(prompt)
+	if err != nil {
+		return "", err
+	}
+	if pass == "" {
+		return "", errors.New("passphrase must not be empty")
+	}
+	if confirmNew {
+		again, err := promptSecret("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != pass {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return pass, nil
+}
+
+func promptSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		pass, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(pass), err
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
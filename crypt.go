@@ -0,0 +1,620 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Encrypted databases are stored as
+//
+//	magic | scrypt logN, r, p | salt | nonce | AES-256-GCM(SQL dump)
+//
+// and are loaded into an in-memory SQLite database on startup. Every commit
+// re-encrypts the dump and atomically replaces the file, so plain data never
+// touches the disk.
+const encryptedMagic = "FINENC01"
+
+const (
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+	saltSize   = 16
+	headerSize = len(encryptedMagic) + 3 + saltSize
+)
+
+var errWrongPassphrase = errors.New("wrong passphrase or corrupted encrypted database")
+
+type encryption struct {
+	key      []byte
+	header   []byte
+	dumpHash [sha256.Size]byte
+	// fileHash is the file as this process last read or wrote it, so a
+	// save notices when another process wrote the file in between.
+	fileHash [sha256.Size]byte
+}
+
+func isEncryptedFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(encryptedMagic))
+	if _, err = io.ReadFull(f, magic); err != nil {
+		return false, nil
+	}
+	return string(magic) == encryptedMagic, nil
+}
+
+func newEncryption(passphrase string) (*encryption, error) {
+	header := make([]byte, 0, headerSize)
+	header = append(header, encryptedMagic...)
+	header = append(header, scryptLogN, scryptR, scryptP)
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	header = append(header, salt...)
+
+	key, err := deriveKey(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+	return &encryption{key: key, header: header}, nil
+}
+
+func deriveKey(passphrase string, header []byte) ([]byte, error) {
+	logN, r, p := header[len(encryptedMagic)], header[len(encryptedMagic)+1], header[len(encryptedMagic)+2]
+	if logN < 10 || logN > 30 || r == 0 || p == 0 {
+		return nil, errors.New("encrypted database header is corrupted")
+	}
+	salt := header[len(encryptedMagic)+3:]
+	return scrypt.Key([]byte(passphrase), salt, 1<<logN, int(r), int(p), 32)
+}
+
+func (e *encryption) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(e.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e *encryption) seal(plain []byte) ([]byte, error) {
+	gcm, err := e.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, e.header...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plain, e.header), nil
+}
+
+func (e *encryption) open(sealed []byte) ([]byte, error) {
+	if len(sealed) < headerSize || !bytes.Equal(sealed[:headerSize], e.header) {
+		return nil, errWrongPassphrase
+	}
+	gcm, err := e.aead()
+	if err != nil {
+		return nil, err
+	}
+	rest := sealed[headerSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errWrongPassphrase
+	}
+	plain, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], e.header)
+	if err != nil {
+		return nil, errWrongPassphrase
+	}
+	return plain, nil
+}
+
+// unlock derives the key for data from the passphrase and decrypts it.
+func unlock(data []byte, passphrase string) (*encryption, []byte, error) {
+	if len(data) < headerSize || string(data[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, nil, errors.New("not an encrypted finance database")
+	}
+	header := append([]byte{}, data[:headerSize]...)
+	key, err := deriveKey(passphrase, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc := &encryption{key: key, header: header}
+	dump, err := enc.open(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc.dumpHash = sha256.Sum256(dump)
+	return enc, dump, nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// dumpDB renders the whole database as an SQL script, much like the sqlite3
+// shell's .dump. Values are rendered by SQLite's quote() so they load back
+// unchanged.
+func dumpDB(ctx context.Context, d *sql.DB) ([]byte, error) {
+	var out bytes.Buffer
+
+	var version int
+	if err := d.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&out, "PRAGMA user_version = %d;\n", version)
+
+	rows, err := d.QueryContext(ctx, `
+        SELECT type, name, sql FROM sqlite_master
+        WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+        ORDER BY type != 'table', rowid`)
+	if err != nil {
+		return nil, err
+	}
+	type object struct{ kind, name, sql string }
+	var objects []object
+	for rows.Next() {
+		var o object
+		if err = rows.Scan(&o.kind, &o.name, &o.sql); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+
+	// Triggers come after the data so they do not fire while loading.
+	var later []string
+	for _, o := range objects {
+		if o.kind != "table" {
+			later = append(later, o.sql)
+			continue
+		}
+		out.WriteString(o.sql + ";\n")
+		if err = dumpRows(ctx, d, &out, o.name); err != nil {
+			return nil, err
+		}
+	}
+
+	var sequences int
+	if err = d.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'sqlite_sequence'").Scan(&sequences); err != nil {
+		return nil, err
+	}
+	if sequences > 0 {
+		out.WriteString("DELETE FROM sqlite_sequence;\n")
+		if err = dumpRows(ctx, d, &out, "sqlite_sequence"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, stmt := range later {
+		out.WriteString(stmt + ";\n")
+	}
+	return out.Bytes(), nil
+}
+
+func dumpRows(ctx context.Context, d *sql.DB, out *bytes.Buffer, table string) error {
+	columns, err := queryStrings(ctx, d, "SELECT name FROM pragma_table_info(?) ORDER BY cid", table)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	for i, c := range columns {
+		columns[i] = "quote(" + quoteIdent(c) + ")"
+	}
+
+	rows, err := d.QueryContext(ctx, "SELECT "+strings.Join(columns, " || ',' || ")+" FROM "+quoteIdent(table)+" ORDER BY rowid")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var values string
+		if err = rows.Scan(&values); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "INSERT INTO %s VALUES(%s);\n", quoteIdent(table), values)
+	}
+	return rows.Err()
+}
+
+func queryStrings(ctx context.Context, q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err = rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// openDump loads an SQL dump into a private in-memory database.
+func openDump(ctx context.Context, dump []byte) (*sql.DB, error) {
+	mem, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// The in-memory database lives and dies with its only connection.
+	mem.SetMaxOpenConns(1)
+	mem.SetMaxIdleConns(1)
+	mem.SetConnMaxLifetime(0)
+	mem.SetConnMaxIdleTime(0)
+
+	if len(dump) > 0 {
+		if _, err = mem.ExecContext(ctx, "BEGIN;\n"+string(dump)+"COMMIT;"); err != nil {
+			mem.Close()
+			return nil, fmt.Errorf("loading database contents: %w", err)
+		}
+	}
+	return mem, nil
+}
+
+func (s *SQLiteStore) passphrase(prompt string) (string, error) {
+	if s.opts.Passphrase == nil {
+		return "", errors.New("database is encrypted and no passphrase was provided")
+	}
+	return s.opts.Passphrase(prompt)
+}
+
+// openEncrypted unlocks the encrypted database file.
+func (s *SQLiteStore) openEncrypted(ctx context.Context) (*sql.DB, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := s.passphrase("Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	enc, dump, err := unlock(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	mem, err := openDump(ctx, dump)
+	if err != nil {
+		return nil, err
+	}
+	enc.fileHash = sha256.Sum256(data)
+	s.enc = enc
+	return mem, nil
+}
+
+// Encrypted reports whether the database file is encrypted.
+func (s *SQLiteStore) Encrypted() bool {
+	return s.enc != nil
+}
+
+// openBackupFile opens a backup for reading. Plain backups are opened
+// read-only in place; encrypted ones are decrypted into memory, with the
+// current key if possible and otherwise with their own passphrase.
+func (s *SQLiteStore) openBackupFile(ctx context.Context, path string) (*sql.DB, error) {
+	encrypted, err := isEncryptedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		return sql.Open("sqlite", "file:"+path+"?mode=ro")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if s.enc != nil {
+		if dump, err := s.enc.open(data); err == nil {
+			return openDump(ctx, dump)
+		}
+	}
+	passphrase, err := s.passphrase("Passphrase for backup: ")
+	if err != nil {
+		return nil, err
+	}
+	_, dump, err := unlock(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return openDump(ctx, dump)
+}
+
+// saveEncrypted writes the in-memory database back to disk when it changed
+// since it was loaded or last saved. It does nothing for plain databases.
+// The encrypted file is rewritten as a whole, so a save is refused with
+// ErrConflict when another process has written the file since it was read;
+// the store has to be reopened then.
+func (s *SQLiteStore) saveEncrypted(ctx context.Context) error {
+	if s.enc == nil {
+		return nil
+	}
+	dump, err := dumpDB(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(dump)
+	if hash == s.enc.dumpHash {
+		return nil
+	}
+	current, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(current) != s.enc.fileHash {
+		return conflictf("the encrypted database was changed by another process, run the command again")
+	}
+	sealed, err := s.enc.seal(dump)
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(s.path, sealed); err != nil {
+		return err
+	}
+	s.enc.dumpHash = hash
+	s.enc.fileHash = sha256.Sum256(sealed)
+	return nil
+}
+
+// PlainBackups lists backups that were written before the database was
+// encrypted and therefore still hold readable data.
+func (s *SQLiteStore) PlainBackups() ([]string, error) {
+	backups, err := s.ListBackups()
+	if err != nil {
+		return nil, err
+	}
+	var plain []string
+	for _, b := range backups {
+		encrypted, err := isEncryptedFile(b.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !encrypted {
+			plain = append(plain, b.Path)
+		}
+	}
+	return plain, nil
+}
+
+func writeEncryptedFile(path string, enc *encryption, dump []byte) error {
+	sealed, err := enc.seal(dump)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, sealed)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// vacuumInto writes a plain copy of src to path through a temporary file,
+// so path is either replaced completely or left alone.
+func vacuumInto(ctx context.Context, src *sql.DB, path string) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := src.ExecContext(ctx, "VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// commit commits tx and, for encrypted databases, persists the result.
+func (s *SQLiteStore) commit(ctx context.Context, tx *sql.Tx) error {
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return s.saveEncrypted(ctx)
+}
+
+// Encrypt converts the plain database file into an encrypted one. The
+// encrypted copy is decrypted and compared before it replaces the original.
+// It fails with ErrConflict while another process has the file open. There
+// is no automatic snapshot first, unlike for Decrypt and Rekey: it would
+// be one more plain copy of the data being encrypted.
+func (s *SQLiteStore) Encrypt(ctx context.Context, passphrase string) error {
+	if s.enc != nil {
+		return invalidf("database is already encrypted")
+	}
+	if passphrase == "" {
+		return invalidf("passphrase must not be empty")
+	}
+	enc, err := newEncryption(passphrase)
+	if err != nil {
+		return err
+	}
+	return s.switchEncryption(ctx, enc)
+}
+
+// Decrypt turns the encrypted database back into a plain SQLite file.
+func (s *SQLiteStore) Decrypt(ctx context.Context) error {
+	if s.enc == nil {
+		return invalidf("database is not encrypted")
+	}
+	if _, err := s.autoBackup(ctx, "pre-decrypt"); err != nil {
+		return fmt.Errorf("backup before decrypting failed: %w", err)
+	}
+	return s.switchEncryption(ctx, nil)
+}
+
+// Rekey re-encrypts the database under a new passphrase and salt.
+func (s *SQLiteStore) Rekey(ctx context.Context, passphrase string) error {
+	if s.enc == nil {
+		return invalidf("database is not encrypted, use encrypt instead")
+	}
+	if passphrase == "" {
+		return invalidf("passphrase must not be empty")
+	}
+	enc, err := newEncryption(passphrase)
+	if err != nil {
+		return err
+	}
+	if _, err = s.autoBackup(ctx, "pre-rekey"); err != nil {
+		return fmt.Errorf("backup before rekeying failed: %w", err)
+	}
+	return s.switchEncryption(ctx, enc)
+}
+
+// switchEncryption rewrites the database file encrypted with enc, or as a
+// plain SQLite file when enc is nil, and reopens it.
+func (s *SQLiteStore) switchEncryption(ctx context.Context, enc *encryption) error {
+	if enc == nil {
+		if err := vacuumInto(ctx, s.db, s.path); err != nil {
+			return err
+		}
+		s.db.Close()
+		s.enc = nil
+		return s.open(ctx)
+	}
+
+	plain := s.enc == nil
+	if plain {
+		if err := s.lockPlainFile(ctx); err != nil {
+			return err
+		}
+	}
+	// fail gives the plain file back to normal connections.
+	fail := func(err error) error {
+		if plain {
+			s.db.Close()
+			if reopenErr := s.open(ctx); reopenErr != nil {
+				return errors.Join(err, reopenErr)
+			}
+		}
+		return err
+	}
+
+	dump, err := dumpDB(ctx, s.db)
+	if err != nil {
+		return fail(err)
+	}
+	sealed, err := enc.seal(dump)
+	if err != nil {
+		return fail(err)
+	}
+	if check, err := enc.open(sealed); err != nil || !bytes.Equal(check, dump) {
+		return fail(errors.New("verification of the encrypted copy failed, database left unchanged"))
+	}
+	mem, err := openDump(ctx, dump)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err = s.db.Close(); err != nil {
+		mem.Close()
+		return fail(err)
+	}
+	if err = writeFileAtomic(s.path, sealed); err != nil {
+		mem.Close()
+		return fail(err)
+	}
+	if plain {
+		// The WAL was emptied into the file that has just been replaced.
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if err = os.Remove(s.path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				mem.Close()
+				return err
+			}
+		}
+	}
+	enc.dumpHash = sha256.Sum256(dump)
+	enc.fileHash = sha256.Sum256(sealed)
+	s.db, s.enc = mem, enc
+	return nil
+}
+
+// lockPlainFile swaps the store's connections for a single one holding an
+// exclusive lock on the plain database file, with the WAL emptied into it.
+// Unlike a checkpoint alone, the lock cannot be taken while another
+// process merely has the file open. On failure the store is left as it was.
+func (s *SQLiteStore) lockPlainFile(ctx context.Context) error {
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	locked, err := sql.Open("sqlite", s.path+"?_pragma=busy_timeout(1000)&_pragma=locking_mode(EXCLUSIVE)")
+	if err == nil {
+		locked.SetMaxOpenConns(1)
+		if err = takeExclusiveLock(ctx, locked); err == nil {
+			s.db = locked
+			return nil
+		}
+		locked.Close()
+	}
+	if reopenErr := s.open(ctx); reopenErr != nil {
+		return errors.Join(err, reopenErr)
+	}
+	return err
+}
+
+func takeExclusiveLock(ctx context.Context, d *sql.DB) error {
+	inUse := conflictf("database is in use by another process, close it there and try again")
+	// In exclusive locking mode the lock taken by the first write is kept
+	// until the connection closes.
+	_, err := d.ExecContext(ctx, "BEGIN EXCLUSIVE; COMMIT")
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY {
+		return inUse
+	}
+	if err != nil {
+		return err
+	}
+	var busy, frames, checkpointed int
+	if err = d.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &frames, &checkpointed); err != nil {
+		return err
+	}
+	if busy != 0 {
+		return inUse
+	}
+	return nil
+}
@@ -1,23 +1,93 @@
-package main
+package tracker
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-var db *sql.DB
+// schemaVersion is stored in PRAGMA user_version. Bump it whenever migrateDB
+// learns a new migration so restore can refuse files from newer builds.
+const schemaVersion = 10
 
-func InitDB() error {
-	var err error
-	db, err = sql.Open("sqlite", "./finance.db")
+// Options configures Open.
+type Options struct {
+	// Passphrase is called with a prompt whenever an encrypted database or
+	// backup has to be unlocked. Encrypted files cannot be opened without it.
+	Passphrase func(prompt string) (string, error)
+	// Command describes what is making the changes, such as a command line.
+	// It is stored with every journal and audit entry.
+	Command string
+	// User is recorded in the audit log. It defaults to the OS account.
+	User string
+}
+
+// SQLiteStore is the Store backed by an SQLite file. Every change it makes
+// is journaled and audited. Several processes may use the same plain file at
+// once: it is opened in WAL mode, waits for locks instead of failing with
+// SQLITE_BUSY, and takes the write lock at the start of every transaction.
+type SQLiteStore struct {
+	db   *sql.DB
+	path string
+	enc  *encryption
+	opts Options
+}
+
+// Open opens the database at path, creating it if needed, and brings its
+// schema up to date.
+func Open(ctx context.Context, path string, opts Options) (*SQLiteStore, error) {
+	s := &SQLiteStore{path: path, opts: opts}
+	if err := s.open(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLiteStore) open(ctx context.Context) error {
+	encrypted, err := isEncryptedFile(s.path)
 	if err != nil {
 		return err
 	}
+	var d *sql.DB
+	if encrypted {
+		d, err = s.openEncrypted(ctx)
+	} else {
+		d, err = sql.Open("sqlite", s.path+sqliteParams)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = migrateDB(ctx, d); err != nil {
+		d.Close()
+		return err
+	}
+	s.db = d
+	return s.saveEncrypted(ctx)
+}
+
+// sqliteParams are applied to every connection to a plain database file.
+// Immediate transactions matter for WAL: a deferred one that reads first
+// cannot upgrade to a writer once another process has committed, and fails
+// with SQLITE_BUSY regardless of the busy timeout.
+const sqliteParams = "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Path returns the database file the store was opened with.
+func (s *SQLiteStore) Path() string {
+	return s.path
+}
 
+func migrateDB(ctx context.Context, db *sql.DB) error {
 	createTable := `
     CREATE TABLE IF NOT EXISTS transactions (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -25,21 +95,34 @@ func InitDB() error {
         category TEXT NOT NULL,
         amount REAL NOT NULL,
         description TEXT,
-        date TEXT NOT NULL
+        date TEXT NOT NULL,
+        deleted_at TEXT,
+        version INTEGER NOT NULL DEFAULT 1,
+        tags TEXT
     );
     `
 
-	_, err = db.Exec(createTable)
+	_, err := db.ExecContext(ctx, createTable)
 	if err != nil {
 		return err
 	}
+	if err = addColumnIfMissing(ctx, db, "transactions", "deleted_at", "TEXT"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing(ctx, db, "transactions", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing(ctx, db, "transactions", "tags", "TEXT"); err != nil {
+		return err
+	}
 	createIndexes := `
     CREATE INDEX IF NOT EXISTS idx_type ON transactions(type);
     CREATE INDEX IF NOT EXISTS idx_date ON transactions(date);
     CREATE INDEX IF NOT EXISTS idx_category ON transactions(category);
+    CREATE INDEX IF NOT EXISTS idx_deleted_at ON transactions(deleted_at);
     `
 
-	_, err = db.Exec(createIndexes)
+	_, err = db.ExecContext(ctx, createIndexes)
 	if err != nil {
 		return err
 	}
@@ -50,66 +133,368 @@ func InitDB() error {
         category TEXT NOT NULL UNIQUE,
         amount REAL NOT NULL,
         period TEXT NOT NULL,
+        anchor TEXT,
         start_date TEXT,
-        end_date TEXT
+        end_date TEXT,
+        rollover TEXT,
+        rollover_cap REAL NOT NULL DEFAULT 0,
+        thresholds TEXT,
+        version INTEGER NOT NULL DEFAULT 1
     );`
 
-	_, err = db.Exec(createBudgetTable)
+	_, err = db.ExecContext(ctx, createBudgetTable)
+	if err != nil {
+		return err
+	}
+	if err = addColumnIfMissing(ctx, db, "budgets", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing(ctx, db, "budgets", "anchor", "TEXT"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing(ctx, db, "budgets", "rollover", "TEXT"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing(ctx, db, "budgets", "rollover_cap", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing(ctx, db, "budgets", "thresholds", "TEXT"); err != nil {
+		return err
+	}
+	if err = createBudgetMovesTable(ctx, db); err != nil {
+		return err
+	}
 
+	// Budgets created before limits had a history get their current
+	// amount as the limit since the start.
+	_, err = db.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS budget_amounts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        category TEXT NOT NULL,
+        amount REAL NOT NULL,
+        effective_from TEXT NOT NULL DEFAULT '',
+        UNIQUE (category, effective_from)
+    );
+    INSERT INTO budget_amounts (category, amount)
+    SELECT category, amount FROM budgets
+    WHERE category NOT IN (SELECT category FROM budget_amounts);
+    `)
+	if err != nil {
+		return err
+	}
+
+	if err = createGoalsTable(ctx, db); err != nil {
+		return err
+	}
+
+	if err = createAssignmentsTable(ctx, db); err != nil {
+		return err
+	}
+
+	if err = createAlertTables(ctx, db); err != nil {
+		return err
+	}
+
+	if err = createRulesTable(ctx, db); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing(ctx, db, "rules", "tags", "TEXT"); err != nil {
+		return err
+	}
+
+	if err = createJournalTables(ctx, db); err != nil {
+		return err
+	}
+
+	if err = createAuditTable(ctx, db); err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
 	return err
 }
 
-func ResetDB() error {
-	_, err := db.Exec("PRAGMA foreign_keys = OFF")
+func addColumnIfMissing(ctx context.Context, db *sql.DB, table, column, definition string) error {
+	columns, err := queryStrings(ctx, db, "SELECT name FROM pragma_table_info(?)", table)
 	if err != nil {
 		return err
 	}
+	for _, name := range columns {
+		if name == column {
+			return nil
+		}
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// Reset deletes all transactions, budgets with their history, budget
+// moves, goals, monthly assignments, alerts, notifiers and rules. It can
+// be undone, and a backup is written first. Ids are not handed out again
+// afterwards, so that undoing it cannot overwrite rows added since.
+func (s *SQLiteStore) Reset(ctx context.Context) error {
+	if _, err := s.autoBackup(ctx, "reset"); err != nil {
+		return fmt.Errorf("backup before reset failed: %w", err)
+	}
 
-	tx, err := db.Begin()
+	_, err := s.db.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
 	if err != nil {
 		return err
 	}
 
-	tables := []string{"transactions", "budgets"}
-	for _, table := range tables {
-		_, err = tx.Exec("DELETE FROM " + table)
+	return s.withJournal(ctx, func(j *journal) error {
+		transactions, err := scanTransactions(ctx, j.tx, "SELECT "+transactionColumns+" FROM transactions ORDER BY id")
+		if err != nil {
+			return err
+		}
+		for i := range transactions {
+			if err = j.transaction(transactions[i].ID, &transactions[i], nil); err != nil {
+				return err
+			}
+		}
+
+		budgets, err := getBudgets(ctx, j.tx)
+		if err != nil {
+			return err
+		}
+		for i := range budgets {
+			if err = j.budget(budgets[i].ID, &budgets[i], nil); err != nil {
+				return err
+			}
+			if err = deleteBudgetAmounts(j, budgets[i].Category); err != nil {
+				return err
+			}
+		}
+
+		moves, err := getBudgetMoves(ctx, j.tx, DateRange{})
+		if err != nil {
+			return err
+		}
+		for i := range moves {
+			if err = j.record("delete", "budget_moves", moves[i].ID, &moves[i], nil); err != nil {
+				return err
+			}
+		}
+
+		goals, err := getGoals(ctx, j.tx)
+		if err != nil {
+			return err
+		}
+		for i := range goals {
+			if err = j.record("delete", "goals", goals[i].ID, &goals[i], nil); err != nil {
+				return err
+			}
+		}
+
+		assignments, err := getAssignments(ctx, j.tx, "SELECT id, month, category, amount FROM assignments ORDER BY id")
+		if err != nil {
+			return err
+		}
+		for i := range assignments {
+			if err = j.record("delete", "assignments", assignments[i].ID, &assignments[i], nil); err != nil {
+				return err
+			}
+		}
+
+		// Alerts go too, or the claims of the old data would keep the new
+		// data's thresholds from firing.
+		alerts, err := getAlerts(ctx, j.tx, 0)
+		if err != nil {
+			return err
+		}
+		for i := range alerts {
+			if err = j.record("delete", "alerts", alerts[i].ID, &alerts[i], nil); err != nil {
+				return err
+			}
+		}
+
+		notifiers, err := getNotifiers(ctx, j.tx)
+		if err != nil {
+			return err
+		}
+		for i := range notifiers {
+			if err = j.record("delete", "notifiers", notifiers[i].ID, &notifiers[i], nil); err != nil {
+				return err
+			}
+		}
+
+		rules, err := getRules(ctx, j.tx)
+		if err != nil {
+			return err
+		}
+		for i := range rules {
+			if err = j.record("delete", "rules", rules[i].ID, &rules[i], nil); err != nil {
+				return err
+			}
+		}
+
+		tables := []string{"transactions", "budgets", "budget_amounts", "budget_moves", "goals", "assignments", "alerts", "notifiers", "rules"}
+		for _, table := range tables {
+			if _, err = j.tx.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+				return err
+			}
+		}
+		if err = s.writeAudit(ctx, j.tx, "reset", "database", 0, nil, nil); err != nil {
+			return err
+		}
+
+		_, err = j.tx.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+		return err
+	})
+}
+
+func (s *SQLiteStore) AddBudget(ctx context.Context, b Budget) error {
+	if err := ValidateBudget(b); err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO budgets (category, amount, period, anchor, start_date, end_date, rollover, rollover_cap, thresholds)
+        VALUES (:category, :amount, :period, :anchor, :start_date, :end_date, :rollover, :rollover_cap, :thresholds)
+    `
+	return s.withJournal(ctx, func(j *journal) error {
+		_, err := getBudget(ctx, j.tx, b.Category)
+		if err == nil {
+			return conflictf("budget for this category already exists")
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		res, err := j.tx.ExecContext(ctx, query, sql.Named("category", b.Category), sql.Named("amount", b.Amount), sql.Named("period", b.Period), sql.Named("anchor", b.Anchor), sql.Named("start_date", b.StartDate), sql.Named("end_date", b.EndDate), sql.Named("rollover", b.Rollover), sql.Named("rollover_cap", b.RolloverCap), sql.Named("thresholds", FormatThresholds(b.Thresholds)))
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
+		b.ID = int(id)
+		b.Version = 1
+		if err = j.budget(b.ID, nil, &b); err != nil {
+			return err
+		}
+		return setBudgetAmount(j, BudgetAmount{Category: b.Category, Amount: b.Amount})
+	})
+}
+
+func (s *SQLiteStore) UpdateBudget(ctx context.Context, category string, amount float64, effective string) error {
+	if err := validateBudgetAmount(amount, effective); err != nil {
+		return err
+	}
 
-		_, err = tx.Exec("DELETE FROM sqlite_sequence WHERE name = ?", table)
+	return s.withJournal(ctx, func(j *journal) error {
+		before, err := getBudget(ctx, j.tx, category)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
+		if err = setBudgetAmount(j, BudgetAmount{Category: category, Amount: amount, EffectiveFrom: effective}); err != nil {
+			return err
+		}
+
+		after := before
+		amounts, err := getBudgetAmounts(ctx, j.tx, category)
+		if err != nil {
+			return err
+		}
+		after.Amount = amountOn(amounts, before.Amount, time.Now().Format(dateLayout))
+		after.Version++
+		res, err := j.tx.ExecContext(ctx, "UPDATE budgets SET amount = ?, version = version + 1 WHERE id = ? AND version = ?", after.Amount, before.ID, before.Version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return conflictf("budget for category %q was changed concurrently", category)
+		}
+		return j.budget(before.ID, &before, &after)
+	})
+}
+
+// setBudgetAmount records a as the limit from its EffectiveFrom date,
+// replacing an existing entry for the same date.
+func setBudgetAmount(j *journal, a BudgetAmount) error {
+	var before BudgetAmount
+	err := j.tx.QueryRowContext(j.ctx, "SELECT id, category, amount, effective_from FROM budget_amounts WHERE category = ? AND effective_from = ?", a.Category, a.EffectiveFrom).
+		Scan(&before.ID, &before.Category, &before.Amount, &before.EffectiveFrom)
+	if errors.Is(err, sql.ErrNoRows) {
+		res, err := j.tx.ExecContext(j.ctx, "INSERT INTO budget_amounts (category, amount, effective_from) VALUES (?, ?, ?)", a.Category, a.Amount, a.EffectiveFrom)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		a.ID = int(id)
+		return j.record("create", "budget_amounts", a.ID, nil, &a)
+	}
+	if err != nil {
+		return err
+	}
+
+	a.ID = before.ID
+	if _, err = j.tx.ExecContext(j.ctx, "UPDATE budget_amounts SET amount = ? WHERE id = ?", a.Amount, a.ID); err != nil {
+		return err
 	}
+	return j.record("update", "budget_amounts", a.ID, &before, &a)
+}
 
-	_, err = tx.Exec("PRAGMA foreign_keys = ON")
+func deleteBudgetAmounts(j *journal, category string) error {
+	amounts, err := getBudgetAmounts(j.ctx, j.tx, category)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
+	for i := range amounts {
+		if _, err = j.tx.ExecContext(j.ctx, "DELETE FROM budget_amounts WHERE id = ?", amounts[i].ID); err != nil {
+			return err
+		}
+		if err = j.record("delete", "budget_amounts", amounts[i].ID, &amounts[i], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	return tx.Commit()
+func (s *SQLiteStore) GetBudgetAmounts(ctx context.Context, category string) ([]BudgetAmount, error) {
+	return getBudgetAmounts(ctx, s.db, category)
 }
 
-func AddBudget(b Budget) error {
-	existing, err := GetBudget(b.Category)
-	if err == nil && existing.ID != 0 {
-		return errors.New("budget for this category already exists")
+func getBudgetAmounts(ctx context.Context, q querier, category string) ([]BudgetAmount, error) {
+	rows, err := q.QueryContext(ctx, "SELECT id, category, amount, effective_from FROM budget_amounts WHERE category = ? ORDER BY effective_from", category)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	query := `
-        INSERT OR REPLACE INTO budgets (category, amount, period, start_date, end_date)
-        VALUES (:category, :amount, :period, :start_date, :end_date)
-    `
-	_, err = db.Exec(query, sql.Named("category", b.Category), sql.Named("amount", b.Amount), sql.Named("period", b.Period), sql.Named("start_date", b.StartDate), sql.Named("end_date", b.EndDate))
-	return err
+	var amounts []BudgetAmount
+	for rows.Next() {
+		var a BudgetAmount
+		if err = rows.Scan(&a.ID, &a.Category, &a.Amount, &a.EffectiveFrom); err != nil {
+			return nil, err
+		}
+		amounts = append(amounts, a)
+	}
+	return amounts, rows.Err()
+}
+
+// budgetColumns read the amount in force today from the budget's history,
+// since a change dated in the future has not taken effect yet when it is
+// made but has once that day comes.
+const budgetColumns = "id, category, " + currentBudgetAmount + ", period, COALESCE(anchor, ''), COALESCE(start_date, ''), COALESCE(end_date, ''), COALESCE(rollover, ''), rollover_cap, COALESCE(thresholds, ''), version"
+
+const currentBudgetAmount = `COALESCE((SELECT a.amount FROM budget_amounts a
+    WHERE a.category = budgets.category AND a.effective_from <= date('now', 'localtime')
+    ORDER BY a.effective_from DESC LIMIT 1), amount)`
+
+func (s *SQLiteStore) GetBudgets(ctx context.Context) ([]Budget, error) {
+	return getBudgets(ctx, s.db)
 }
 
-func GetBudgets() ([]Budget, error) {
-	rows, err := db.Query("SELECT id, category, amount, period, start_date, end_date FROM budgets")
+func getBudgets(ctx context.Context, q querier) ([]Budget, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+budgetColumns+" FROM budgets ORDER BY id")
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +502,7 @@ func GetBudgets() ([]Budget, error) {
 
 	var budgets []Budget
 	for rows.Next() {
-		var b Budget
-		err = rows.Scan(&b.ID, &b.Category, &b.Amount, &b.Period, &b.StartDate, &b.EndDate)
+		b, err := scanBudget(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -127,97 +511,166 @@ func GetBudgets() ([]Budget, error) {
 	return budgets, nil
 }
 
-func GetBudget(category string) (Budget, error) {
+func scanBudget(row interface{ Scan(...interface{}) error }) (Budget, error) {
 	var b Budget
-	row := db.QueryRow("SELECT id, category, amount, period, start_date, end_date FROM budgets WHERE category = ?", category)
-	err := row.Scan(&b.ID, &b.Category, &b.Amount, &b.Period, &b.StartDate, &b.EndDate)
+	var thresholds string
+	err := row.Scan(&b.ID, &b.Category, &b.Amount, &b.Period, &b.Anchor, &b.StartDate, &b.EndDate, &b.Rollover, &b.RolloverCap, &thresholds, &b.Version)
+	if err != nil {
+		return b, err
+	}
+	b.Thresholds, err = ParseThresholds(thresholds)
 	return b, err
 }
 
-func RemoveBudget(category string) error {
-	_, err := db.Exec("DELETE FROM budgets WHERE category = ?", category)
-	return err
+func (s *SQLiteStore) GetBudget(ctx context.Context, category string) (Budget, error) {
+	return getBudget(ctx, s.db, category)
 }
 
-func CheckBudget(category string, period string) (currentSpent, budgetAmount float64, err error) {
-	b, err := GetBudget(category)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, 0, nil
-		}
-		return 0, 0, err
+func getBudget(ctx context.Context, q querier, category string) (Budget, error) {
+	b, err := scanBudget(q.QueryRowContext(ctx, "SELECT "+budgetColumns+" FROM budgets WHERE category = ?", category))
+	if errors.Is(err, sql.ErrNoRows) {
+		return b, notFoundf("no budget for category %q", category)
 	}
+	return b, err
+}
 
-	var whereClause string
-	switch period {
-	case "monthly":
-		whereClause = "strftime('%Y-%m', date) = strftime('%Y-%m', 'now')"
-	case "weekly":
-		whereClause = "date >= date('now', 'weekday 0', '-7 days') AND date <= date('now')"
-	case "yearly":
-		whereClause = "strftime('%Y', date) = strftime('%Y', 'now')"
-	default:
-		whereClause = "1=1"
+func (s *SQLiteStore) RemoveBudget(ctx context.Context, category string) error {
+	return s.withJournal(ctx, func(j *journal) error {
+		b, err := getBudget(ctx, j.tx, category)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = j.tx.ExecContext(ctx, "DELETE FROM budgets WHERE id = ?", b.ID); err != nil {
+			return err
+		}
+		if err = j.budget(b.ID, &b, nil); err != nil {
+			return err
+		}
+		return deleteBudgetAmounts(j, b.Category)
+	})
+}
+
+func (s *SQLiteStore) AddTransaction(ctx context.Context, t Transaction) (int, error) {
+	if err := ValidateTransaction(t); err != nil {
+		return 0, err
 	}
 
-	query := fmt.Sprintf(`
-        SELECT COALESCE(SUM(amount), 0)
-        FROM transactions
-        WHERE type = 'expense' AND category = ? AND %s
-    `, whereClause)
+	t.Tags = JoinTags(t.Tags)
 
-	row := db.QueryRow(query, category)
-	err = row.Scan(&currentSpent)
+	query := `
+        INSERT INTO transactions (type, category, amount, description, tags, date)
+        VALUES (:type, :category, :amount, :description, NULLIF(:tags, ''), :date)
+        `
+	err := s.withJournal(ctx, func(j *journal) error {
+		res, err := j.tx.ExecContext(ctx, query, sql.Named("type", t.Type), sql.Named("category", t.Category), sql.Named("amount", t.Amount), sql.Named("description", t.Description), sql.Named("tags", t.Tags), sql.Named("date", t.Date))
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		t.ID = int(id)
+		t.DeletedAt = ""
+		t.Version = 1
+		return j.transaction(t.ID, nil, &t)
+	})
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
-
-	return currentSpent, b.Amount, nil
+	return t.ID, nil
 }
 
-func AddTransaction(t Transaction) error {
-	query := `
-        INSERT INTO transactions (type, category, amount, description, date)
-        VALUES (:type, :category, :amount, :description, :date)
-        `
-	_, err := db.Exec(query, sql.Named("type", t.Type), sql.Named("category", t.Category), sql.Named("amount", t.Amount), sql.Named("description", t.Description), sql.Named("date", t.Date))
-	return err
+const transactionColumns = "id, type, category, amount, COALESCE(description, ''), COALESCE(tags, ''), date, COALESCE(deleted_at, ''), version"
+
+var transactionSortColumns = map[string]string{
+	"date":     "date",
+	"amount":   "amount",
+	"category": "category",
+	"id":       "id",
 }
 
-func GetTransactions(tType, category, startDate, endDate string, limit int) ([]Transaction, error) {
-	query := "SELECT id, type, category, amount, description, date FROM transactions"
-	var conditions []string
+func transactionConditions(f TransactionFilter) (string, []interface{}) {
+	conditions := []string{"deleted_at IS NULL"}
 	var args []interface{}
 
-	if tType != "" {
+	if f.Trashed {
+		conditions[0] = "deleted_at IS NOT NULL"
+	}
+	if f.Type != "" {
 		conditions = append(conditions, "type = ?")
-		args = append(args, tType)
+		args = append(args, f.Type)
 	}
-	if category != "" {
+	if f.Category != "" {
 		conditions = append(conditions, "category = ?")
-		args = append(args, category)
+		args = append(args, f.Category)
 	}
-	if startDate != "" {
+	if f.StartDate != "" {
 		conditions = append(conditions, "date >= ?")
-		args = append(args, startDate)
+		args = append(args, f.StartDate)
 	}
-	if endDate != "" {
+	if f.EndDate != "" {
 		conditions = append(conditions, "date <= ?")
-		args = append(args, endDate)
+		args = append(args, f.EndDate)
+	}
+	if f.MinAmount > 0 {
+		conditions = append(conditions, "amount >= ?")
+		args = append(args, f.MinAmount)
+	}
+	if f.MaxAmount > 0 {
+		conditions = append(conditions, "amount <= ?")
+		args = append(args, f.MaxAmount)
 	}
+	if clause, whereArgs := f.Where.clause(); clause != "" {
+		conditions = append(conditions, clause)
+		args = append(args, whereArgs...)
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
 
-	if len(conditions) > 0 {
-		query += " WHERE " + strings.Join(conditions, " AND ")
+func sortField(f TransactionFilter) (string, error) {
+	if f.SortBy == "" {
+		return "date", nil
 	}
+	if _, ok := transactionSortColumns[f.SortBy]; !ok {
+		return "", invalidf("invalid sort field %q, must be date, amount, category or id", f.SortBy)
+	}
+	return f.SortBy, nil
+}
 
-	query += " ORDER BY date DESC"
+func (s *SQLiteStore) GetTransactions(ctx context.Context, f TransactionFilter) ([]Transaction, error) {
+	query := "SELECT " + transactionColumns + " FROM transactions"
+	where, args := transactionConditions(f)
+	query += where
 
-	if limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, limit)
+	sortBy, err := sortField(f)
+	if err != nil {
+		return nil, err
+	}
+	direction := "DESC"
+	if f.Ascending {
+		direction = "ASC"
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", transactionSortColumns[sortBy], direction, direction)
+
+	if f.Limit > 0 || f.Offset > 0 {
+		limit := f.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, f.Offset)
 	}
 
-	rows, err := db.Query(query, args...)
+	return scanTransactions(ctx, s.db, query, args...)
+}
+
+func scanTransactions(ctx context.Context, q querier, query string, args ...interface{}) ([]Transaction, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -226,7 +679,7 @@ func GetTransactions(tType, category, startDate, endDate string, limit int) ([]T
 	var transactions []Transaction
 	for rows.Next() {
 		var t Transaction
-		err = rows.Scan(&t.ID, &t.Type, &t.Category, &t.Amount, &t.Description, &t.Date)
+		err = rows.Scan(&t.ID, &t.Type, &t.Category, &t.Amount, &t.Description, &t.Tags, &t.Date, &t.DeletedAt, &t.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -235,8 +688,20 @@ func GetTransactions(tType, category, startDate, endDate string, limit int) ([]T
 	return transactions, nil
 }
 
-func UpdateTransaction(id int, t Transaction) error {
-	query := "UPDATE transactions SET "
+func (s *SQLiteStore) GetTransactionTotals(ctx context.Context, f TransactionFilter) (TransactionTotals, error) {
+	where, args := transactionConditions(f)
+	query := `
+        SELECT COUNT(*),
+               COALESCE(SUM(CASE WHEN type = 'income' THEN amount END), 0),
+               COALESCE(SUM(CASE WHEN type = 'expense' THEN amount END), 0)
+        FROM transactions` + where
+
+	var totals TransactionTotals
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&totals.Count, &totals.Income, &totals.Expense)
+	return totals, err
+}
+
+func transactionUpdates(t Transaction) ([]string, []interface{}) {
 	var updates []string
 	var args []interface{}
 
@@ -248,7 +713,7 @@ func UpdateTransaction(id int, t Transaction) error {
 		updates = append(updates, "category = ?")
 		args = append(args, t.Category)
 	}
-	if t.Amount >= 0 {
+	if t.Amount > 0 {
 		updates = append(updates, "amount = ?")
 		args = append(args, t.Amount)
 	}
@@ -256,57 +721,298 @@ func UpdateTransaction(id int, t Transaction) error {
 		updates = append(updates, "description = ?")
 		args = append(args, t.Description)
 	}
+	if t.Tags != "" {
+		updates = append(updates, "tags = ?")
+		args = append(args, JoinTags(t.Tags))
+	}
 	if t.Date != "" {
 		updates = append(updates, "date = ?")
 		args = append(args, t.Date)
 	}
+	return updates, args
+}
+
+func (s *SQLiteStore) GetTransaction(ctx context.Context, id int) (Transaction, error) {
+	return getTransaction(ctx, s.db, id)
+}
+
+func getTransaction(ctx context.Context, q querier, id int) (Transaction, error) {
+	var t Transaction
+	row := q.QueryRowContext(ctx, "SELECT "+transactionColumns+" FROM transactions WHERE id = ?", id)
+	err := row.Scan(&t.ID, &t.Type, &t.Category, &t.Amount, &t.Description, &t.Tags, &t.Date, &t.DeletedAt, &t.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, notFoundf("transaction #%d not found", id)
+	}
+	return t, err
+}
+
+// liveTransaction loads a transaction that an update or delete is about to
+// change; trashed transactions have to be restored first.
+func liveTransaction(ctx context.Context, q querier, id int) (Transaction, error) {
+	t, err := getTransaction(ctx, q, id)
+	if err != nil {
+		return t, err
+	}
+	if t.DeletedAt != "" {
+		return t, conflictf("transaction #%d is in the trash", id)
+	}
+	return t, nil
+}
+
+// checkAffected turns an UPDATE of a row read earlier in the same
+// transaction that matched nothing into an error.
+func checkAffected(res sql.Result, id int) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return conflictf("transaction #%d was changed concurrently", id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) UpdateTransaction(ctx context.Context, id int, t Transaction) error {
+	if updates, _ := transactionUpdates(t); len(updates) == 0 {
+		return invalidf("nothing to update")
+	}
+	if err := ValidatePatch(t); err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE transactions
+        SET type = :type, category = :category, amount = :amount, description = :description, tags = NULLIF(:tags, ''), date = :date,
+            version = version + 1
+        WHERE id = :id AND version = :version AND deleted_at IS NULL
+        `
+	return s.withJournal(ctx, func(j *journal) error {
+		before, err := liveTransaction(ctx, j.tx, id)
+		if err != nil {
+			return err
+		}
+		if t.Version != 0 && t.Version != before.Version {
+			return staleVersion(id, t.Version, before.Version)
+		}
+		after := mergeTransaction(before, t)
+		if err = ValidateTransaction(after); err != nil {
+			return err
+		}
+		res, err := j.tx.ExecContext(ctx, query, sql.Named("type", after.Type), sql.Named("category", after.Category), sql.Named("amount", after.Amount), sql.Named("description", after.Description), sql.Named("tags", after.Tags), sql.Named("date", after.Date), sql.Named("id", id), sql.Named("version", before.Version))
+		if err != nil {
+			return err
+		}
+		if err = checkAffected(res, id); err != nil {
+			return err
+		}
+		after.Version++
+		return j.transaction(id, &before, &after)
+	})
+}
+
+func (s *SQLiteStore) PatchTransactions(ctx context.Context, updates map[int]Transaction) (int64, error) {
+	ids := make([]int, 0, len(updates))
+	for id, t := range updates {
+		if u, _ := transactionUpdates(t); len(u) == 0 {
+			return 0, invalidf("nothing to update for transaction #%d", id)
+		}
+		if err := ValidatePatch(t); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var affected int64
+	err := s.withJournal(ctx, func(j *journal) error {
+		for _, id := range ids {
+			before, err := liveTransaction(ctx, j.tx, id)
+			if errors.Is(err, ErrNotFound) {
+				return conflictf("transaction #%d no longer exists", id)
+			}
+			if err != nil {
+				return err
+			}
+			t := updates[id]
+			if t.Version != 0 && t.Version != before.Version {
+				return staleVersion(id, t.Version, before.Version)
+			}
+			after := mergeTransaction(before, t)
+			if err = ValidateTransaction(after); err != nil {
+				return err
+			}
+			_, err = j.tx.ExecContext(ctx, `
+                UPDATE transactions
+                SET type = ?, category = ?, amount = ?, description = ?, tags = NULLIF(?, ''), date = ?, version = version + 1
+                WHERE id = ?`,
+				after.Type, after.Category, after.Amount, after.Description, after.Tags, after.Date, id)
+			if err != nil {
+				return err
+			}
+			after.Version++
+			if err = j.transaction(id, &before, &after); err != nil {
+				return err
+			}
+			affected++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
 
+func (s *SQLiteStore) DeleteTransaction(ctx context.Context, id int) error {
+	query := `UPDATE transactions SET deleted_at = :deleted_at, version = version + 1 WHERE id = :id AND version = :version AND deleted_at IS NULL`
+	return s.withJournal(ctx, func(j *journal) error {
+		before, err := liveTransaction(ctx, j.tx, id)
+		if err != nil {
+			return err
+		}
+		after := before
+		after.DeletedAt = time.Now().Format("2006-01-02 15:04:05")
+		after.Version++
+		res, err := j.tx.ExecContext(ctx, query, sql.Named("deleted_at", after.DeletedAt), sql.Named("id", id), sql.Named("version", before.Version))
+		if err != nil {
+			return err
+		}
+		if err = checkAffected(res, id); err != nil {
+			return err
+		}
+		return j.transaction(id, &before, &after)
+	})
+}
+
+const bulkChunkSize = 500
+
+func (s *SQLiteStore) BulkUpdateTransactions(ctx context.Context, versions map[int]int, t Transaction) (int64, error) {
+	updates, updateArgs := transactionUpdates(t)
 	if len(updates) == 0 {
-		return errors.New("nothing to update")
+		return 0, invalidf("nothing to update")
+	}
+	if err := ValidatePatch(t); err != nil {
+		return 0, err
 	}
+	setClause := strings.Join(updates, ", ")
 
-	query += strings.Join(updates, ", ")
-	query += " WHERE id = ?"
-	args = append(args, id)
+	return s.execInChunks(ctx, versions, func(tx *sql.Tx, placeholders string, idArgs []interface{}) (sql.Result, error) {
+		query := "UPDATE transactions SET " + setClause + ", version = version + 1 WHERE deleted_at IS NULL AND id IN (" + placeholders + ")"
+		return tx.ExecContext(ctx, query, append(append([]interface{}{}, updateArgs...), idArgs...)...)
+	})
+}
 
-	_, err := db.Exec(query, args...)
-	return err
+func (s *SQLiteStore) BulkDeleteTransactions(ctx context.Context, versions map[int]int) (int64, error) {
+	deletedAt := time.Now().Format("2006-01-02 15:04:05")
+	return s.execInChunks(ctx, versions, func(tx *sql.Tx, placeholders string, idArgs []interface{}) (sql.Result, error) {
+		query := "UPDATE transactions SET deleted_at = ?, version = version + 1 WHERE deleted_at IS NULL AND id IN (" + placeholders + ")"
+		return tx.ExecContext(ctx, query, append([]interface{}{deletedAt}, idArgs...)...)
+	})
 }
 
-func DeleteTransaction(id int) error {
-	query := `DELETE FROM transactions WHERE id = :id`
-	_, err := db.Exec(query, sql.Named("id", id))
-	return err
+func (s *SQLiteStore) execInChunks(ctx context.Context, versions map[int]int, exec func(tx *sql.Tx, placeholders string, idArgs []interface{}) (sql.Result, error)) (int64, error) {
+	ids := make([]int, 0, len(versions))
+	for id := range versions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var affected int64
+	err := s.withJournal(ctx, func(j *journal) error {
+		for start := 0; start < len(ids); start += bulkChunkSize {
+			end := start + bulkChunkSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			chunk := ids[start:end]
+
+			idArgs := make([]interface{}, len(chunk))
+			for i, id := range chunk {
+				idArgs[i] = id
+			}
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ")
+			selectChunk := "SELECT " + transactionColumns + " FROM transactions WHERE id IN (" + placeholders + ")"
+
+			before, err := scanTransactions(ctx, j.tx, selectChunk, idArgs...)
+			if err != nil {
+				return err
+			}
+			beforeByID := make(map[int]Transaction, len(before))
+			for _, t := range before {
+				beforeByID[t.ID] = t
+			}
+			for _, id := range chunk {
+				current, found := beforeByID[id]
+				if _, err = bulkTarget(id, versions[id], current, found); err != nil {
+					return err
+				}
+			}
+			res, err := exec(j.tx, placeholders, idArgs)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			affected += n
+			after, err := scanTransactions(ctx, j.tx, selectChunk, idArgs...)
+			if err != nil {
+				return err
+			}
+
+			if err = journalTransactionChanges(j, before, after); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
 }
 
-func GetBalance(period, startDate, endDate string) (income, expense float64, err error) {
-	var whereClause string
+func journalTransactionChanges(j *journal, before, after []Transaction) error {
+	afterByID := make(map[int]*Transaction, len(after))
+	for i := range after {
+		afterByID[after[i].ID] = &after[i]
+	}
+	for i := range before {
+		if err := j.transaction(before[i].ID, &before[i], afterByID[before[i].ID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func statsConditions(r DateRange, where Filter) (string, []interface{}) {
+	conditions := []string{"deleted_at IS NULL"}
 	var args []interface{}
 
-	switch period {
-	case "day":
-		whereClause = "date = date('now')"
-	case "week":
-		whereClause = "date >= date('now', 'weekday 0', '-7 days') AND date <= date('now')"
-	case "month":
-		whereClause = "strftime('%Y-%m', date) = strftime('%Y-%m', 'now')"
-	case "year":
-		whereClause = "strftime('%Y', date) = strftime('%Y', 'now')"
-	case "custom":
-		if startDate == "" || endDate == "" {
-			return 0, 0, errors.New("start and end dates required for custom period")
-		}
-		whereClause = "date BETWEEN ? AND ?"
-		args = append(args, startDate, endDate)
-	default:
-		whereClause = "1=1"
+	if r.Start != "" {
+		conditions = append(conditions, "date >= ?")
+		args = append(args, r.Start)
 	}
+	if r.End != "" {
+		conditions = append(conditions, "date <= ?")
+		args = append(args, r.End)
+	}
+	if clause, whereArgs := where.clause(); clause != "" {
+		conditions = append(conditions, clause)
+		args = append(args, whereArgs...)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (s *SQLiteStore) GetBalance(ctx context.Context, r DateRange, where Filter) (income, expense float64, err error) {
+	whereClause, args := statsConditions(r, where)
 
 	query := fmt.Sprintf(`
         SELECT COALESCE(SUM(amount), 0)
         FROM transactions
         WHERE type = 'income' AND %s`, whereClause)
-	row := db.QueryRow(query, args...)
+	row := s.db.QueryRowContext(ctx, query, args...)
 	err = row.Scan(&income)
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to get income: %w", err)
@@ -316,7 +1022,7 @@ func GetBalance(period, startDate, endDate string) (income, expense float64, err
         SELECT COALESCE(SUM(amount), 0)
         FROM transactions
         WHERE type = 'expense' AND %s`, whereClause)
-	row = db.QueryRow(query, args...)
+	row = s.db.QueryRowContext(ctx, query, args...)
 	err = row.Scan(&expense)
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to get expense: %w", err)
@@ -326,43 +1032,17 @@ func GetBalance(period, startDate, endDate string) (income, expense float64, err
 
 }
 
-func GetCategoryStats(period, startDate, endDate string) (map[string]float64, error) {
+func (s *SQLiteStore) GetCategoryStats(ctx context.Context, r DateRange, where Filter) (map[string]float64, error) {
 	stats := make(map[string]float64)
 
+	whereClause, args := statsConditions(r, where)
 	query := `
-        SELECT category, SUM(amount) 
-        FROM transactions 
-        WHERE type = 'expense'
-    `
-
-	var args []interface{}
-	var conditions []string
-
-	switch period {
-	case "day":
-		conditions = append(conditions, "date = date('now')")
-	case "week":
-		conditions = append(conditions, "date >= date('now', 'weekday 0', '-7 days')")
-		conditions = append(conditions, "date <= date('now')")
-	case "month":
-		conditions = append(conditions, "strftime('%Y-%m', date) = strftime('%Y-%m', 'now')")
-	case "year":
-		conditions = append(conditions, "strftime('%Y', date) = strftime('%Y', 'now')")
-	case "custom":
-		if startDate == "" || endDate == "" {
-			return nil, errors.New("start and end dates required for custom period")
-		}
-		conditions = append(conditions, "date BETWEEN ? AND ?")
-		args = append(args, startDate, endDate)
-	}
-
-	if len(conditions) > 0 {
-		query += " AND " + strings.Join(conditions, " AND ")
-	}
-
-	query += " GROUP BY category"
+        SELECT category, SUM(amount)
+        FROM transactions
+        WHERE type = 'expense' AND ` + whereClause + `
+        GROUP BY category`
 
-	rows, err := db.Query(query, args...)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
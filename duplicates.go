@@ -0,0 +1,220 @@
+package tracker
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DuplicateOptions says how alike two transactions have to be to look
+// like the same one entered twice.
+type DuplicateOptions struct {
+	// Days is how far apart their dates may be; 3 when zero.
+	Days int
+	// AmountTolerance is how far apart their amounts may be, as a fraction
+	// of the larger one. Zero requires the same amount to the cent.
+	AmountTolerance float64
+	// Similarity is how alike their descriptions must be, from 0 to 1;
+	// 0.8 when zero.
+	Similarity float64
+}
+
+const (
+	defaultDuplicateDays       = 3
+	defaultDuplicateSimilarity = 0.8
+)
+
+func (o DuplicateOptions) withDefaults() (DuplicateOptions, error) {
+	if o.Days < 0 || o.AmountTolerance < 0 || o.AmountTolerance >= 1 || o.Similarity < 0 || o.Similarity > 1 {
+		return o, invalidf("invalid duplicate options: days and tolerance cannot be negative, tolerance must be below 1 and similarity between 0 and 1")
+	}
+	if o.Days == 0 {
+		o.Days = defaultDuplicateDays
+	}
+	if o.Similarity == 0 {
+		o.Similarity = defaultDuplicateSimilarity
+	}
+	return o, nil
+}
+
+// duplicateOf reports whether a and b look like the same transaction.
+func (o DuplicateOptions) duplicateOf(a, b Transaction) bool {
+	if d := daysBetween(a.Date, b.Date); d > o.Days || d < -o.Days {
+		return false
+	}
+	return o.alike(a, b)
+}
+
+// alike is duplicateOf whatever the dates.
+func (o DuplicateOptions) alike(a, b Transaction) bool {
+	if a.Type != b.Type || !strings.EqualFold(a.Category, b.Category) {
+		return false
+	}
+	if diff := math.Abs(a.Amount - b.Amount); diff >= 0.005 && diff > o.AmountTolerance*math.Max(a.Amount, b.Amount) {
+		return false
+	}
+	return Similarity(a.Description, b.Description) >= o.Similarity
+}
+
+// Similarity compares two descriptions from 0 (nothing alike) to 1 (the
+// same, ignoring case and spacing), by their edit distance.
+func Similarity(a, b string) float64 {
+	x := []rune(strings.Join(strings.Fields(strings.ToLower(a)), " "))
+	y := []rune(strings.Join(strings.Fields(strings.ToLower(b)), " "))
+	longest := max(len(x), len(y))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(x, y))/float64(longest)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			diagonal, row[j] = row[j], min(row[j]+1, row[j-1]+1, diagonal+cost)
+		}
+	}
+	return row[len(b)]
+}
+
+// FindDuplicates groups the transactions in r that look like the same one
+// entered more than once. Each group starts with its oldest transaction
+// and holds those within the allowed number of days of it; groups are in
+// date order.
+func FindDuplicates(ctx context.Context, s Store, r DateRange, opts DuplicateOptions) ([][]Transaction, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.GetTransactions(ctx, TransactionFilter{StartDate: r.Start, EndDate: r.End, SortBy: "date", Ascending: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]Transaction
+	grouped := make(map[int]bool)
+	for i, t := range transactions {
+		if grouped[t.ID] {
+			continue
+		}
+		group := []Transaction{t}
+		for _, other := range transactions[i+1:] {
+			if daysBetween(t.Date, other.Date) > opts.Days {
+				break
+			}
+			if !grouped[other.ID] && opts.duplicateOf(t, other) {
+				group = append(group, other)
+			}
+		}
+		if len(group) > 1 {
+			for _, member := range group {
+				grouped[member.ID] = true
+			}
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// PossibleDuplicates returns the stored transactions that t, which is
+// about to be added, would duplicate.
+func PossibleDuplicates(ctx context.Context, s Store, t Transaction, opts DuplicateOptions) ([]Transaction, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	date, err := time.Parse(dateLayout, t.Date)
+	if err != nil {
+		return nil, invalidf("invalid date format, use YYYY-MM-DD")
+	}
+	candidates, err := s.GetTransactions(ctx, TransactionFilter{
+		Type:      t.Type,
+		StartDate: date.AddDate(0, 0, -opts.Days).Format(dateLayout),
+		EndDate:   date.AddDate(0, 0, opts.Days).Format(dateLayout),
+		SortBy:    "date",
+		Ascending: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var duplicates []Transaction
+	for _, c := range candidates {
+		if opts.duplicateOf(t, c) {
+			duplicates = append(duplicates, c)
+		}
+	}
+	return duplicates, nil
+}
+
+// mergeIDs checks the arguments of MergeTransactions and drops repeated
+// ids.
+func mergeIDs(keep int, duplicates []int) ([]int, error) {
+	if len(duplicates) == 0 {
+		return nil, invalidf("no duplicates to merge")
+	}
+	if slices.Contains(duplicates, keep) {
+		return nil, invalidf("transaction #%d cannot be merged into itself", keep)
+	}
+	ids := slices.Clone(duplicates)
+	sort.Ints(ids)
+	return slices.Compact(ids), nil
+}
+
+func (s *SQLiteStore) MergeTransactions(ctx context.Context, keep int, duplicates []int) error {
+	ids, err := mergeIDs(keep, duplicates)
+	if err != nil {
+		return err
+	}
+
+	return s.withJournal(ctx, func(j *journal) error {
+		kept, err := liveTransaction(ctx, j.tx, keep)
+		if err != nil {
+			return err
+		}
+		description := kept.Description
+		deletedAt := time.Now().Format("2006-01-02 15:04:05")
+		for _, id := range ids {
+			before, err := liveTransaction(ctx, j.tx, id)
+			if err != nil {
+				return err
+			}
+			if description == "" {
+				description = before.Description
+			}
+			after := before
+			after.DeletedAt = deletedAt
+			after.Version++
+			if _, err = j.tx.ExecContext(ctx, "UPDATE transactions SET deleted_at = ?, version = version + 1 WHERE id = ?", deletedAt, id); err != nil {
+				return err
+			}
+			if err = j.transaction(id, &before, &after); err != nil {
+				return err
+			}
+		}
+
+		if description == kept.Description {
+			return nil
+		}
+		after := kept
+		after.Description = description
+		after.Version++
+		if _, err = j.tx.ExecContext(ctx, "UPDATE transactions SET description = ?, version = version + 1 WHERE id = ?", description, keep); err != nil {
+			return err
+		}
+		return j.transaction(keep, &kept, &after)
+	})
+}
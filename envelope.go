@@ -0,0 +1,219 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const (
+	RolloverNone    = "none"
+	RolloverSurplus = "surplus"
+	RolloverBoth    = "both"
+	RolloverCapped  = "capped"
+)
+
+// BudgetMove moves money from the envelope of one budget to another in the
+// period containing Date.
+type BudgetMove struct {
+	ID     int
+	Date   string
+	From   string
+	To     string
+	Amount float64
+	Note   string
+}
+
+// Envelope is a budget seen as an envelope of money for one period.
+// Available is Assigned + Carried + Moved - Spent.
+type Envelope struct {
+	Category string
+	Window   DateRange
+	Assigned float64
+	// Carried is what rolled over from the previous period, negative when
+	// an overspend was carried.
+	Carried float64
+	// Moved is the net amount moved into the envelope during the period.
+	Moved     float64
+	Spent     float64
+	Available float64
+}
+
+// carry is the part of an envelope's leftover that rolls into the next
+// period under the budget's rollover mode.
+func (b Budget) carry(available float64) float64 {
+	switch b.Rollover {
+	case RolloverSurplus:
+		return max(available, 0)
+	case RolloverBoth:
+		return available
+	case RolloverCapped:
+		return min(max(available, 0), b.RolloverCap)
+	default:
+		return 0
+	}
+}
+
+func validateMove(m BudgetMove) error {
+	if m.Amount <= 0 {
+		return invalidf("amount must be positive")
+	}
+	if m.From == "" || m.To == "" {
+		return invalidf("both categories are required")
+	}
+	if m.From == m.To {
+		return invalidf("cannot move money from a category to itself")
+	}
+	if _, err := time.Parse(dateLayout, m.Date); err != nil {
+		return invalidf("invalid date format, use YYYY-MM-DD")
+	}
+	return nil
+}
+
+// Envelopes returns the envelope of every budget active on date, for the
+// period containing date. Budgets that roll over are replayed period by
+// period from their StartDate.
+func Envelopes(ctx context.Context, s Store, date time.Time) ([]Envelope, error) {
+	budgets, err := s.GetBudgets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	moves, err := s.GetBudgetMoves(ctx, DateRange{End: truncateDay(date).Format(dateLayout)})
+	if err != nil {
+		return nil, err
+	}
+
+	var envelopes []Envelope
+	for _, b := range budgets {
+		current, ok := BudgetWindow(b, date)
+		if !ok {
+			continue
+		}
+		first := current
+		if b.Rollover != "" && b.Rollover != RolloverNone {
+			start, _ := time.Parse(dateLayout, b.StartDate)
+			first, _ = BudgetWindow(b, start)
+		}
+
+		amounts, err := s.GetBudgetAmounts(ctx, b.Category)
+		if err != nil {
+			return nil, err
+		}
+		expenses, err := s.GetTransactions(ctx, TransactionFilter{Type: "expense", Category: b.Category, StartDate: first.Start, EndDate: current.End})
+		if err != nil {
+			return nil, err
+		}
+
+		var carried float64
+		window := first
+		for {
+			e := Envelope{Category: b.Category, Window: window, Assigned: amountOn(amounts, b.Amount, window.End), Carried: carried}
+			for _, t := range expenses {
+				if window.contains(t.Date) {
+					e.Spent += t.Amount
+				}
+			}
+			for _, m := range moves {
+				if !window.contains(m.Date) {
+					continue
+				}
+				if m.To == b.Category {
+					e.Moved += m.Amount
+				}
+				if m.From == b.Category {
+					e.Moved -= m.Amount
+				}
+			}
+			e.Available = e.Assigned + e.Carried + e.Moved - e.Spent
+			if window == current {
+				envelopes = append(envelopes, e)
+				break
+			}
+			carried = b.carry(e.Available)
+			end, _ := time.Parse(dateLayout, window.End)
+			window, _ = BudgetWindow(b, end.AddDate(0, 0, 1))
+		}
+	}
+	return envelopes, nil
+}
+
+func createBudgetMovesTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS budget_moves (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        date TEXT NOT NULL,
+        from_category TEXT NOT NULL,
+        to_category TEXT NOT NULL,
+        amount REAL NOT NULL,
+        note TEXT
+    );
+    CREATE INDEX IF NOT EXISTS idx_budget_moves_date ON budget_moves(date);
+    `)
+	return err
+}
+
+func (s *SQLiteStore) MoveMoney(ctx context.Context, m BudgetMove) (int, error) {
+	if err := validateMove(m); err != nil {
+		return 0, err
+	}
+
+	err := s.withJournal(ctx, func(j *journal) error {
+		for _, category := range []string{m.From, m.To} {
+			if _, err := getBudget(ctx, j.tx, category); err != nil {
+				return err
+			}
+		}
+		res, err := j.tx.ExecContext(ctx, "INSERT INTO budget_moves (date, from_category, to_category, amount, note) VALUES (?, ?, ?, ?, ?)",
+			m.Date, m.From, m.To, m.Amount, m.Note)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		m.ID = int(id)
+		return j.record("create", "budget_moves", m.ID, nil, &m)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return m.ID, nil
+}
+
+func (s *SQLiteStore) GetBudgetMoves(ctx context.Context, r DateRange) ([]BudgetMove, error) {
+	return getBudgetMoves(ctx, s.db, r)
+}
+
+func getBudgetMoves(ctx context.Context, q querier, r DateRange) ([]BudgetMove, error) {
+	var conditions []string
+	var args []interface{}
+	if r.Start != "" {
+		conditions = append(conditions, "date >= ?")
+		args = append(args, r.Start)
+	}
+	if r.End != "" {
+		conditions = append(conditions, "date <= ?")
+		args = append(args, r.End)
+	}
+	query := "SELECT id, date, from_category, to_category, amount, COALESCE(note, '') FROM budget_moves"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := q.QueryContext(ctx, query+" ORDER BY date, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var moves []BudgetMove
+	for rows.Next() {
+		var m BudgetMove
+		if err = rows.Scan(&m.ID, &m.Date, &m.From, &m.To, &m.Amount, &m.Note); err != nil {
+			return nil, err
+		}
+		moves = append(moves, m)
+	}
+	return moves, rows.Err()
+}
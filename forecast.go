@@ -0,0 +1,270 @@
+package tracker
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Recurring is a series of transactions with the same type, category and
+// description that repeats at a regular interval.
+type Recurring struct {
+	Type        string
+	Category    string
+	Description string
+	// Amount is the average of the last three occurrences.
+	Amount float64
+	// Interval is weekly, biweekly, monthly, quarterly or yearly.
+	Interval string
+	Last     string
+	Next     string
+}
+
+// recurringIntervals are tried in order; an occurrence may be off its
+// expected date by up to tolerance days.
+var recurringIntervals = []struct {
+	name      string
+	tolerance int
+}{
+	{"weekly", 1},
+	{"biweekly", 2},
+	{"monthly", 3},
+	{"quarterly", 5},
+	{"yearly", 7},
+}
+
+// minOccurrences is how often a series must have happened to count as
+// recurring.
+const minOccurrences = 3
+
+func recurringKey(t Transaction) string {
+	return t.Type + "\x00" + t.Category + "\x00" + strings.ToLower(strings.TrimSpace(t.Description))
+}
+
+// DetectRecurring finds the recurring series among transactions dated up
+// to now. A series has to have happened at least three times, every time
+// close to one interval after the last, and must not have missed its
+// latest occurrence.
+func DetectRecurring(transactions []Transaction, now time.Time) []Recurring {
+	today := truncateDay(now)
+	groups := make(map[string][]Transaction)
+	for _, t := range transactions {
+		if t.Date <= today.Format(dateLayout) {
+			groups[recurringKey(t)] = append(groups[recurringKey(t)], t)
+		}
+	}
+
+	var series []Recurring
+	for _, group := range groups {
+		if len(group) < minOccurrences {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].Date < group[j].Date })
+		dates := make([]time.Time, len(group))
+		for i, t := range group {
+			dates[i], _ = time.Parse(dateLayout, t.Date)
+		}
+
+		for _, interval := range recurringIntervals {
+			p := budgetPeriods[interval.name]
+			if !regular(dates, p, interval.tolerance) {
+				continue
+			}
+			last := dates[len(dates)-1]
+			if today.Sub(p.add(last, 1)).Hours()/24 > float64(interval.tolerance) {
+				break
+			}
+			recent := group[max(len(group)-3, 0):]
+			total := 0.0
+			for _, t := range recent {
+				total += t.Amount
+			}
+			series = append(series, Recurring{
+				Type:        group[0].Type,
+				Category:    group[0].Category,
+				Description: group[len(group)-1].Description,
+				Amount:      total / float64(len(recent)),
+				Interval:    interval.name,
+				Last:        last.Format(dateLayout),
+				Next:        nextOccurrence(last, p, today).Format(dateLayout),
+			})
+			break
+		}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Next != series[j].Next {
+			return series[i].Next < series[j].Next
+		}
+		return series[i].Category < series[j].Category
+	})
+	return series
+}
+
+func recurringTolerance(interval string) int {
+	for _, i := range recurringIntervals {
+		if i.name == interval {
+			return i.tolerance
+		}
+	}
+	return 0
+}
+
+func enteredNear(entered map[string]bool, key string, date time.Time, tolerance int) bool {
+	for d := -tolerance; d <= tolerance; d++ {
+		if entered[key+date.AddDate(0, 0, d).Format(dateLayout)] {
+			return true
+		}
+	}
+	return false
+}
+
+func regular(dates []time.Time, p budgetPeriod, tolerance int) bool {
+	for i := 1; i < len(dates); i++ {
+		if math.Abs(dates[i].Sub(p.add(dates[i-1], 1)).Hours()/24) > float64(tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+// nextOccurrence is the first occurrence after today, counted from last
+// so that month lengths do not make the series drift.
+func nextOccurrence(last time.Time, p budgetPeriod, today time.Time) time.Time {
+	n := 1
+	for !p.add(last, n).After(today) {
+		n++
+	}
+	return p.add(last, n)
+}
+
+// ForecastDay is the projected balance at the end of one day. Low and
+// High bound it with 90% confidence given how much day-to-day spending
+// varied in the past.
+type ForecastDay struct {
+	Date    string
+	Income  float64
+	Expense float64
+	Balance float64
+	Low     float64
+	High    float64
+}
+
+// Forecast projects the balance day by day from recurring transactions,
+// transactions already entered for future dates, and the average daily
+// spending per category of everything else. Income that does not recur
+// is not projected.
+type Forecast struct {
+	Balance   float64
+	Days      []ForecastDay
+	Recurring []Recurring
+	// Discretionary is the average daily spending per category outside
+	// recurring series, over the history the forecast was based on.
+	Discretionary map[string]float64
+	// Lowest is the day with the lowest projected balance.
+	Lowest ForecastDay
+	// NextPayday is the next date of recurring income, empty if there is
+	// none.
+	NextPayday string
+}
+
+// confidenceZ is the z-score of a two-sided 90% confidence band.
+const confidenceZ = 1.645
+
+// ForecastBalance projects balance, the balance at the end of now, over
+// the next days days, learning spending from the history days before now.
+func ForecastBalance(ctx context.Context, s Store, now time.Time, balance float64, days, history int) (Forecast, error) {
+	if days <= 0 {
+		return Forecast{}, invalidf("number of days must be positive")
+	}
+	if history <= 0 {
+		return Forecast{}, invalidf("history must be a positive number of days")
+	}
+	today := truncateDay(now)
+	end := today.AddDate(0, 0, days)
+	transactions, err := s.GetTransactions(ctx, TransactionFilter{EndDate: end.Format(dateLayout)})
+	if err != nil {
+		return Forecast{}, err
+	}
+
+	f := Forecast{Balance: balance, Recurring: DetectRecurring(transactions, today), Discretionary: make(map[string]float64)}
+	recurring := make(map[string]bool)
+	for _, r := range f.Recurring {
+		recurring[recurringKey(Transaction{Type: r.Type, Category: r.Category, Description: r.Description})] = true
+		if r.Type == "income" && (f.NextPayday == "" || r.Next < f.NextPayday) {
+			f.NextPayday = r.Next
+		}
+	}
+
+	// Everything outside the recurring series in the history window is
+	// discretionary; its daily totals give the spread of the band.
+	from := today.AddDate(0, 0, -history).Format(dateLayout)
+	daily := make([]float64, history)
+	scheduled := make(map[string][2]float64)
+	entered := make(map[string]bool)
+	for _, t := range transactions {
+		switch {
+		case t.Date > today.Format(dateLayout):
+			day := scheduled[t.Date]
+			if t.Type == "income" {
+				day[0] += t.Amount
+			} else {
+				day[1] += t.Amount
+			}
+			scheduled[t.Date] = day
+			entered[recurringKey(t)+t.Date] = true
+		case t.Type == "expense" && t.Date > from && !recurring[recurringKey(t)]:
+			f.Discretionary[t.Category] += t.Amount / float64(history)
+			date, _ := time.Parse(dateLayout, t.Date)
+			daily[history-1-int(today.Sub(date).Hours()/24)] += t.Amount
+		}
+	}
+	mean, variance := 0.0, 0.0
+	for _, v := range daily {
+		mean += v / float64(history)
+	}
+	for _, v := range daily {
+		variance += (v - mean) * (v - mean) / float64(history)
+	}
+	sd := math.Sqrt(variance)
+
+	// Project each recurring series onto its dates, unless the
+	// occurrence has already been entered ahead of time.
+	due := make(map[string][2]float64)
+	for _, r := range f.Recurring {
+		last, _ := time.Parse(dateLayout, r.Last)
+		p := budgetPeriods[r.Interval]
+		key := recurringKey(Transaction{Type: r.Type, Category: r.Category, Description: r.Description})
+		for n := 1; !p.add(last, n).After(end); n++ {
+			date := p.add(last, n)
+			if !date.After(today) || enteredNear(entered, key, date, recurringTolerance(r.Interval)) {
+				continue
+			}
+			day := due[date.Format(dateLayout)]
+			if r.Type == "income" {
+				day[0] += r.Amount
+			} else {
+				day[1] += r.Amount
+			}
+			due[date.Format(dateLayout)] = day
+		}
+	}
+
+	for i := 1; i <= days; i++ {
+		date := today.AddDate(0, 0, i).Format(dateLayout)
+		day := ForecastDay{
+			Date:    date,
+			Income:  scheduled[date][0] + due[date][0],
+			Expense: scheduled[date][1] + due[date][1] + mean,
+		}
+		balance += day.Income - day.Expense
+		spread := confidenceZ * sd * math.Sqrt(float64(i))
+		day.Balance, day.Low, day.High = balance, balance-spread, balance+spread
+		f.Days = append(f.Days, day)
+		if i == 1 || day.Balance < f.Lowest.Balance {
+			f.Lowest = day
+		}
+	}
+	return f, nil
+}
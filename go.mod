@@ -1,9 +1,11 @@
-module main
+module github.com/MusticDaubi/tracker
 
 go 1.24.1
 
 require (
+	golang.org/x/crypto v0.40.0
 	golang.org/x/sys v0.34.0
+	golang.org/x/term v0.33.0
 	modernc.org/sqlite v1.38.2
 )
 
@@ -0,0 +1,232 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	GoalSavings = "savings"
+	GoalIncome  = "income"
+)
+
+// Goal is something to reach rather than a limit to stay under. A savings
+// goal counts money put into its category (expenses minus income there,
+// so withdrawals count against it), or the net balance when it has no
+// category. An income goal counts income in its category, or all income.
+type Goal struct {
+	ID         int
+	Name       string
+	Kind       string
+	Category   string
+	Target     float64
+	TargetDate string
+	// StartDate is when contributions start counting; empty means all
+	// history.
+	StartDate string
+	Version   int
+}
+
+// GoalStatus is the progress of a goal as of one day.
+type GoalStatus struct {
+	Goal      Goal
+	Saved     float64
+	Remaining float64
+	// MonthlyNeeded is what still has to come in each month to reach the
+	// target by TargetDate. Once the date has passed it is all of Remaining.
+	MonthlyNeeded float64
+	// MonthlyRate is the average monthly contribution over the last
+	// goalRateMonths months.
+	MonthlyRate float64
+	// Projected is the date the target is reached at MonthlyRate, empty
+	// when the goal is reached or the rate is not positive.
+	Projected string
+}
+
+// Ratio is the share of the target that has been reached.
+func (st GoalStatus) Ratio() float64 {
+	return st.Saved / st.Goal.Target
+}
+
+// goalRateMonths is how far back GoalProgress looks for the recent
+// contribution rate.
+const goalRateMonths = 3
+
+const daysPerMonth = 365.25 / 12
+
+func ValidateGoal(g Goal) error {
+	if g.Name == "" {
+		return invalidf("name is required")
+	}
+	if g.Kind != GoalSavings && g.Kind != GoalIncome {
+		return invalidf("invalid kind %q, must be savings or income", g.Kind)
+	}
+	if g.Target <= 0 {
+		return invalidf("target must be positive")
+	}
+	if _, err := time.Parse(dateLayout, g.TargetDate); err != nil {
+		return invalidf("invalid target date format, use YYYY-MM-DD")
+	}
+	if g.StartDate != "" {
+		if _, err := time.Parse(dateLayout, g.StartDate); err != nil {
+			return invalidf("invalid start date format, use YYYY-MM-DD")
+		}
+		if g.TargetDate < g.StartDate {
+			return invalidf("target date cannot be before start date")
+		}
+	}
+	return nil
+}
+
+// contributed sums what counts towards g over r.
+func (g Goal) contributed(ctx context.Context, s Store, r DateRange) (float64, error) {
+	totals, err := s.GetTransactionTotals(ctx, TransactionFilter{Category: g.Category, StartDate: r.Start, EndDate: r.End})
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case g.Kind == GoalIncome:
+		return totals.Income, nil
+	case g.Category != "":
+		return totals.Expense - totals.Income, nil
+	default:
+		return totals.Income - totals.Expense, nil
+	}
+}
+
+// GoalProgress evaluates g as of now.
+func GoalProgress(ctx context.Context, s Store, g Goal, now time.Time) (GoalStatus, error) {
+	today := truncateDay(now)
+	st := GoalStatus{Goal: g}
+
+	var err error
+	st.Saved, err = g.contributed(ctx, s, DateRange{g.StartDate, today.Format(dateLayout)})
+	if err != nil {
+		return GoalStatus{}, err
+	}
+	st.Remaining = max(g.Target-st.Saved, 0)
+
+	targetDate, _ := time.Parse(dateLayout, g.TargetDate)
+	st.MonthlyNeeded = st.Remaining
+	if monthsLeft := targetDate.Sub(today).Hours() / 24 / daysPerMonth; monthsLeft > 1 {
+		st.MonthlyNeeded = st.Remaining / monthsLeft
+	}
+
+	recent := DateRange{addMonths(today, -goalRateMonths).AddDate(0, 0, 1).Format(dateLayout), today.Format(dateLayout)}
+	if g.StartDate > recent.Start {
+		recent.Start = g.StartDate
+	}
+	if recent.Start <= recent.End {
+		amount, err := g.contributed(ctx, s, recent)
+		if err != nil {
+			return GoalStatus{}, err
+		}
+		start, _ := time.Parse(dateLayout, recent.Start)
+		days := today.Sub(start).Hours()/24 + 1
+		st.MonthlyRate = amount / (days / daysPerMonth)
+	}
+
+	if st.Remaining > 0 && st.MonthlyRate > 0 {
+		days := math.Ceil(st.Remaining / st.MonthlyRate * daysPerMonth)
+		st.Projected = today.AddDate(0, 0, int(days)).Format(dateLayout)
+	}
+	return st, nil
+}
+
+func createGoalsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS goals (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL UNIQUE,
+        kind TEXT NOT NULL,
+        category TEXT,
+        target REAL NOT NULL,
+        target_date TEXT NOT NULL,
+        start_date TEXT,
+        version INTEGER NOT NULL DEFAULT 1
+    );`)
+	return err
+}
+
+func (s *SQLiteStore) AddGoal(ctx context.Context, g Goal) error {
+	if err := ValidateGoal(g); err != nil {
+		return err
+	}
+
+	return s.withJournal(ctx, func(j *journal) error {
+		_, err := getGoal(ctx, j.tx, g.Name)
+		if err == nil {
+			return conflictf("goal %q already exists", g.Name)
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		res, err := j.tx.ExecContext(ctx, "INSERT INTO goals (name, kind, category, target, target_date, start_date) VALUES (?, ?, ?, ?, ?, ?)",
+			g.Name, g.Kind, g.Category, g.Target, g.TargetDate, g.StartDate)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		g.ID = int(id)
+		g.Version = 1
+		return j.record("create", "goals", g.ID, nil, &g)
+	})
+}
+
+const goalColumns = "id, name, kind, COALESCE(category, ''), target, target_date, COALESCE(start_date, ''), version"
+
+func (s *SQLiteStore) GetGoals(ctx context.Context) ([]Goal, error) {
+	return getGoals(ctx, s.db)
+}
+
+func getGoals(ctx context.Context, q querier) ([]Goal, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+goalColumns+" FROM goals ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var goals []Goal
+	for rows.Next() {
+		var g Goal
+		if err = rows.Scan(&g.ID, &g.Name, &g.Kind, &g.Category, &g.Target, &g.TargetDate, &g.StartDate, &g.Version); err != nil {
+			return nil, err
+		}
+		goals = append(goals, g)
+	}
+	return goals, rows.Err()
+}
+
+func (s *SQLiteStore) GetGoal(ctx context.Context, name string) (Goal, error) {
+	return getGoal(ctx, s.db, name)
+}
+
+func getGoal(ctx context.Context, q querier, name string) (Goal, error) {
+	var g Goal
+	err := q.QueryRowContext(ctx, "SELECT "+goalColumns+" FROM goals WHERE name = ?", name).
+		Scan(&g.ID, &g.Name, &g.Kind, &g.Category, &g.Target, &g.TargetDate, &g.StartDate, &g.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return g, notFoundf("no goal named %q", name)
+	}
+	return g, err
+}
+
+func (s *SQLiteStore) RemoveGoal(ctx context.Context, name string) error {
+	return s.withJournal(ctx, func(j *journal) error {
+		g, err := getGoal(ctx, j.tx, name)
+		if err != nil {
+			return err
+		}
+		if _, err = j.tx.ExecContext(ctx, "DELETE FROM goals WHERE id = ?", g.ID); err != nil {
+			return err
+		}
+		return j.record("delete", "goals", g.ID, &g, nil)
+	})
+}
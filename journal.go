@@ -0,0 +1,450 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type JournalEntry struct {
+	ID        int
+	Command   string
+	CreatedAt string
+	Undone    bool
+	Added     int
+	Updated   int
+	Deleted   int
+}
+
+type JournalChange struct {
+	Table  string
+	RowID  int
+	Before string
+	After  string
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// journal records before and after images of every row a mutating command
+// touches, inside the same SQL transaction as the mutation itself. The
+// journal entry is only created once the first change is recorded, so
+// commands that end up changing nothing leave no trace.
+type journal struct {
+	ctx   context.Context
+	store *SQLiteStore
+	tx    *sql.Tx
+	id    int64
+}
+
+func createJournalTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS journal (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        command TEXT NOT NULL,
+        created_at TEXT NOT NULL,
+        undone INTEGER NOT NULL DEFAULT 0
+    );
+    CREATE TABLE IF NOT EXISTS journal_changes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        journal_id INTEGER NOT NULL REFERENCES journal(id),
+        table_name TEXT NOT NULL,
+        row_id INTEGER NOT NULL,
+        before TEXT,
+        after TEXT
+    );
+    CREATE INDEX IF NOT EXISTS idx_journal_changes_journal ON journal_changes(journal_id);
+    `)
+	return err
+}
+
+func (s *SQLiteStore) withJournal(ctx context.Context, fn func(j *journal) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(&journal{ctx: ctx, store: s, tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return s.commit(ctx, tx)
+}
+
+func (j *journal) record(action, table string, rowID int, before, after interface{}) error {
+	if j.id == 0 {
+		// A new change invalidates everything that could still be redone.
+		_, err := j.tx.ExecContext(j.ctx, "DELETE FROM journal_changes WHERE journal_id IN (SELECT id FROM journal WHERE undone = 1)")
+		if err != nil {
+			return err
+		}
+		_, err = j.tx.ExecContext(j.ctx, "DELETE FROM journal WHERE undone = 1")
+		if err != nil {
+			return err
+		}
+
+		res, err := j.tx.ExecContext(j.ctx, "INSERT INTO journal (command, created_at) VALUES (?, ?)",
+			j.store.opts.Command, time.Now().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			return err
+		}
+		if j.id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	beforeImage, err := rowImage(before)
+	if err != nil {
+		return err
+	}
+	afterImage, err := rowImage(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = j.tx.ExecContext(j.ctx,
+		"INSERT INTO journal_changes (journal_id, table_name, row_id, before, after) VALUES (?, ?, ?, ?, ?)",
+		j.id, table, rowID, beforeImage, afterImage)
+	if err != nil {
+		return err
+	}
+	return j.store.writeAudit(j.ctx, j.tx, action, table, rowID, before, after)
+}
+
+func (j *journal) transaction(id int, before, after *Transaction) error {
+	var b, a interface{}
+	action := "update"
+	switch {
+	case before == nil:
+		action = "create"
+	case after == nil:
+		action = "delete"
+	case before.DeletedAt == "" && after.DeletedAt != "":
+		action = "trash"
+	case before.DeletedAt != "" && after.DeletedAt == "":
+		action = "restore"
+	}
+	if before != nil {
+		b = before
+	}
+	if after != nil {
+		a = after
+	}
+	return j.record(action, "transactions", id, b, a)
+}
+
+func (j *journal) budget(id int, before, after *Budget) error {
+	var b, a interface{}
+	action := "update"
+	if before == nil {
+		action = "create"
+	} else if after == nil {
+		action = "delete"
+	}
+	if before != nil {
+		b = before
+	}
+	if after != nil {
+		a = after
+	}
+	return j.record(action, "budgets", id, b, a)
+}
+
+func rowImage(row interface{}) (sql.NullString, error) {
+	if row == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func imageValue(image sql.NullString) interface{} {
+	if !image.Valid {
+		return nil
+	}
+	return json.RawMessage(image.String)
+}
+
+// restoredVersion is the version a row gets when undo or redo writes an
+// older image back. It is newer than both the current row and the image, so
+// a client still holding the version from before the undo cannot slip an
+// update through. It takes the row id and the image version as arguments.
+func restoredVersion(table string) string {
+	return "MAX(COALESCE((SELECT version FROM " + table + " WHERE id = ?), 0), ?) + 1"
+}
+
+func restoreRow(ctx context.Context, tx *sql.Tx, table string, rowID int, image sql.NullString) error {
+	if !image.Valid {
+		_, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE id = ?", rowID)
+		return err
+	}
+
+	switch table {
+	case "transactions":
+		var t Transaction
+		if err := json.Unmarshal([]byte(image.String), &t); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+            INSERT OR REPLACE INTO transactions (id, type, category, amount, description, tags, date, deleted_at, version)
+            VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, NULLIF(?, ''), `+restoredVersion("transactions")+`)`,
+			rowID, t.Type, t.Category, t.Amount, t.Description, t.Tags, t.Date, t.DeletedAt, rowID, t.Version)
+		return err
+	case "budgets":
+		var b Budget
+		if err := json.Unmarshal([]byte(image.String), &b); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+            INSERT OR REPLACE INTO budgets (id, category, amount, period, anchor, start_date, end_date, rollover, rollover_cap, thresholds, version)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, `+restoredVersion("budgets")+`)`,
+			rowID, b.Category, b.Amount, b.Period, b.Anchor, b.StartDate, b.EndDate, b.Rollover, b.RolloverCap, FormatThresholds(b.Thresholds), rowID, b.Version)
+		return err
+	case "budget_amounts":
+		var a BudgetAmount
+		if err := json.Unmarshal([]byte(image.String), &a); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO budget_amounts (id, category, amount, effective_from) VALUES (?, ?, ?, ?)",
+			rowID, a.Category, a.Amount, a.EffectiveFrom)
+		return err
+	case "goals":
+		var g Goal
+		if err := json.Unmarshal([]byte(image.String), &g); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+            INSERT OR REPLACE INTO goals (id, name, kind, category, target, target_date, start_date, version)
+            VALUES (?, ?, ?, ?, ?, ?, ?, `+restoredVersion("goals")+`)`,
+			rowID, g.Name, g.Kind, g.Category, g.Target, g.TargetDate, g.StartDate, rowID, g.Version)
+		return err
+	case "assignments":
+		var a Assignment
+		if err := json.Unmarshal([]byte(image.String), &a); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO assignments (id, month, category, amount) VALUES (?, ?, ?, ?)",
+			rowID, a.Month, a.Category, a.Amount)
+		return err
+	case "notifiers":
+		var c NotifierConfig
+		if err := json.Unmarshal([]byte(image.String), &c); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO notifiers (id, kind, target, server) VALUES (?, ?, ?, ?)",
+			rowID, c.Kind, c.Target, c.Server)
+		return err
+	case "alerts":
+		var a Alert
+		if err := json.Unmarshal([]byte(image.String), &a); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+            INSERT OR REPLACE INTO alerts (id, category, period_start, period_end, threshold, spent, budget_limit, sent_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			rowID, a.Category, a.Window.Start, a.Window.End, a.Threshold, a.Spent, a.Limit, a.SentAt)
+		return err
+	case "rules":
+		var r Rule
+		if err := json.Unmarshal([]byte(image.String), &r); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+            INSERT OR REPLACE INTO rules (id, type, pattern, payee, min_amount, max_amount, category, tags, rewrite)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			rowID, r.Type, r.Pattern, r.Payee, r.MinAmount, r.MaxAmount, r.Category, r.Tags, r.Rewrite)
+		return err
+	case "budget_moves":
+		var m BudgetMove
+		if err := json.Unmarshal([]byte(image.String), &m); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+            INSERT OR REPLACE INTO budget_moves (id, date, from_category, to_category, amount, note)
+            VALUES (?, ?, ?, ?, ?, ?)`,
+			rowID, m.Date, m.From, m.To, m.Amount, m.Note)
+		return err
+	default:
+		return fmt.Errorf("journal references unknown table %q", table)
+	}
+}
+
+// Undo reverts the last n operations that have not been undone yet, newest
+// first, and returns the entries it reverted.
+func (s *SQLiteStore) Undo(ctx context.Context, n int) ([]JournalEntry, error) {
+	return s.replayJournal(ctx, n, true)
+}
+
+// Redo re-applies the last n undone operations in their original order.
+func (s *SQLiteStore) Redo(ctx context.Context, n int) ([]JournalEntry, error) {
+	return s.replayJournal(ctx, n, false)
+}
+
+func (s *SQLiteStore) replayJournal(ctx context.Context, n int, undo bool) ([]JournalEntry, error) {
+	if n <= 0 {
+		return nil, invalidf("number of operations must be positive")
+	}
+
+	pick := "SELECT id FROM journal WHERE undone = 0 ORDER BY id DESC LIMIT ?"
+	order := "DESC"
+	if !undo {
+		pick = "SELECT id FROM journal WHERE undone = 1 ORDER BY id ASC LIMIT ?"
+		order = "ASC"
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := queryInts(ctx, tx, pick, n)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	for _, id := range ids {
+		rows, err := tx.QueryContext(ctx, "SELECT table_name, row_id, before, after FROM journal_changes WHERE journal_id = ? ORDER BY id "+order, id)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		type change struct {
+			table         string
+			rowID         int
+			before, after sql.NullString
+		}
+		var changes []change
+		for rows.Next() {
+			var c change
+			if err = rows.Scan(&c.table, &c.rowID, &c.before, &c.after); err != nil {
+				rows.Close()
+				tx.Rollback()
+				return nil, err
+			}
+			changes = append(changes, c)
+		}
+		rows.Close()
+
+		for _, c := range changes {
+			action, current, image := "redo", c.before, c.after
+			if undo {
+				action, current, image = "undo", c.after, c.before
+			}
+			if err = restoreRow(ctx, tx, c.table, c.rowID, image); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if err = s.writeAudit(ctx, tx, action, c.table, c.rowID, imageValue(current), imageValue(image)); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+
+		if _, err = tx.ExecContext(ctx, "UPDATE journal SET undone = ? WHERE id = ?", undo, id); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	entries, err := journalEntries(ctx, tx, ids)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return entries, s.commit(ctx, tx)
+}
+
+func queryInts(ctx context.Context, q querier, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []int
+	for rows.Next() {
+		var v int
+		if err = rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+const journalEntryQuery = `
+    SELECT j.id, j.command, j.created_at, j.undone,
+           COALESCE(SUM(c.before IS NULL), 0),
+           COALESCE(SUM(c.before IS NOT NULL AND c.after IS NOT NULL), 0),
+           COALESCE(SUM(c.after IS NULL), 0)
+    FROM journal j
+    LEFT JOIN journal_changes c ON c.journal_id = j.id
+    `
+
+func journalEntries(ctx context.Context, q querier, ids []int) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for _, id := range ids {
+		var e JournalEntry
+		err := q.QueryRowContext(ctx, journalEntryQuery+" WHERE j.id = ? GROUP BY j.id", id).Scan(
+			&e.ID, &e.Command, &e.CreatedAt, &e.Undone, &e.Added, &e.Updated, &e.Deleted)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *SQLiteStore) GetJournal(ctx context.Context, limit int) ([]JournalEntry, error) {
+	query := journalEntryQuery + " GROUP BY j.id ORDER BY j.id DESC"
+	var args []interface{}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []JournalEntry
+	for rows.Next() {
+		var e JournalEntry
+		err = rows.Scan(&e.ID, &e.Command, &e.CreatedAt, &e.Undone, &e.Added, &e.Updated, &e.Deleted)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *SQLiteStore) GetJournalChanges(ctx context.Context, id int) ([]JournalChange, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT table_name, row_id, COALESCE(before, ''), COALESCE(after, '') FROM journal_changes WHERE journal_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []JournalChange
+	for rows.Next() {
+		var c JournalChange
+		if err = rows.Scan(&c.Table, &c.RowID, &c.Before, &c.After); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
@@ -0,0 +1,717 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps everything in memory. It follows the
+// same rules as SQLiteStore but has no journal, audit log or persistence.
+type MemoryStore struct {
+	mu                sync.Mutex
+	transactions      map[int]Transaction
+	budgets           map[int]Budget
+	lastTransactionID int
+	lastBudgetID      int
+	amounts           map[string][]BudgetAmount
+	lastAmountID      int
+	moves             []BudgetMove
+	goals             []Goal
+	lastGoalID        int
+	assignments       []Assignment
+	lastAssignmentID  int
+	alerts            []Alert
+	notifiers         []NotifierConfig
+	lastNotifierID    int
+	rules             []Rule
+	lastRuleID        int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		transactions: make(map[int]Transaction),
+		budgets:      make(map[int]Budget),
+		amounts:      make(map[string][]BudgetAmount),
+	}
+}
+
+func (s *MemoryStore) AddTransaction(ctx context.Context, t Transaction) (int, error) {
+	if err := ValidateTransaction(t); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastTransactionID++
+	t.ID = s.lastTransactionID
+	t.Tags = JoinTags(t.Tags)
+	t.DeletedAt = ""
+	t.Version = 1
+	s.transactions[t.ID] = t
+	return t.ID, nil
+}
+
+func (s *MemoryStore) GetTransaction(ctx context.Context, id int) (Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.transactions[id]
+	if !ok {
+		return Transaction{}, notFoundf("transaction #%d not found", id)
+	}
+	return t, nil
+}
+
+func (s *MemoryStore) matching(f TransactionFilter) []Transaction {
+	var result []Transaction
+	for _, t := range s.transactions {
+		if (t.DeletedAt != "") != f.Trashed {
+			continue
+		}
+		if f.Type != "" && t.Type != f.Type {
+			continue
+		}
+		if f.Category != "" && t.Category != f.Category {
+			continue
+		}
+		if !(DateRange{f.StartDate, f.EndDate}).contains(t.Date) {
+			continue
+		}
+		if f.MinAmount > 0 && t.Amount < f.MinAmount {
+			continue
+		}
+		if f.MaxAmount > 0 && t.Amount > f.MaxAmount {
+			continue
+		}
+		if !f.Where.Match(t) {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+func (s *MemoryStore) GetTransactions(ctx context.Context, f TransactionFilter) ([]Transaction, error) {
+	sortBy, err := sortField(f)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	result := s.matching(f)
+	s.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		var c int
+		switch sortBy {
+		case "date":
+			c = strings.Compare(a.Date, b.Date)
+		case "amount":
+			c = compareValues(a.Amount, b.Amount)
+		case "category":
+			c = strings.Compare(a.Category, b.Category)
+		}
+		if c == 0 {
+			c = a.ID - b.ID
+		}
+		if f.Ascending {
+			return c < 0
+		}
+		return c > 0
+	})
+
+	if f.Offset >= len(result) {
+		return nil, nil
+	}
+	result = result[f.Offset:]
+	if f.Limit > 0 && f.Limit < len(result) {
+		result = result[:f.Limit]
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) GetTransactionTotals(ctx context.Context, f TransactionFilter) (TransactionTotals, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var totals TransactionTotals
+	for _, t := range s.matching(f) {
+		totals.Count++
+		switch t.Type {
+		case "income":
+			totals.Income += t.Amount
+		case "expense":
+			totals.Expense += t.Amount
+		}
+	}
+	return totals, nil
+}
+
+// live returns the transaction an update or delete is about to change.
+func (s *MemoryStore) live(id int) (Transaction, error) {
+	t, ok := s.transactions[id]
+	if !ok {
+		return t, notFoundf("transaction #%d not found", id)
+	}
+	if t.DeletedAt != "" {
+		return t, conflictf("transaction #%d is in the trash", id)
+	}
+	return t, nil
+}
+
+func (s *MemoryStore) UpdateTransaction(ctx context.Context, id int, t Transaction) error {
+	if updates, _ := transactionUpdates(t); len(updates) == 0 {
+		return invalidf("nothing to update")
+	}
+	if err := ValidatePatch(t); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.live(id)
+	if err != nil {
+		return err
+	}
+	if t.Version != 0 && t.Version != current.Version {
+		return staleVersion(id, t.Version, current.Version)
+	}
+	updated := mergeTransaction(current, t)
+	if err = ValidateTransaction(updated); err != nil {
+		return err
+	}
+	updated.Version++
+	s.transactions[id] = updated
+	return nil
+}
+
+func (s *MemoryStore) DeleteTransaction(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.live(id)
+	if err != nil {
+		return err
+	}
+	current.DeletedAt = time.Now().Format("2006-01-02 15:04:05")
+	current.Version++
+	s.transactions[id] = current
+	return nil
+}
+
+func (s *MemoryStore) RestoreTransaction(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.transactions[id]
+	if !ok {
+		return notFoundf("transaction #%d not found", id)
+	}
+	if t.DeletedAt == "" {
+		return conflictf("transaction #%d is not in the trash", id)
+	}
+	t.DeletedAt = ""
+	t.Version++
+	s.transactions[id] = t
+	return nil
+}
+
+func (s *MemoryStore) BulkUpdateTransactions(ctx context.Context, versions map[int]int, t Transaction) (int64, error) {
+	if updates, _ := transactionUpdates(t); len(updates) == 0 {
+		return 0, invalidf("nothing to update")
+	}
+	if err := ValidatePatch(t); err != nil {
+		return 0, err
+	}
+	return s.eachLive(versions, func(current Transaction) Transaction {
+		return mergeTransaction(current, t)
+	})
+}
+
+func (s *MemoryStore) BulkDeleteTransactions(ctx context.Context, versions map[int]int) (int64, error) {
+	deletedAt := time.Now().Format("2006-01-02 15:04:05")
+	return s.eachLive(versions, func(current Transaction) Transaction {
+		current.DeletedAt = deletedAt
+		return current
+	})
+}
+
+func (s *MemoryStore) MergeTransactions(ctx context.Context, keep int, duplicates []int) error {
+	ids, err := mergeIDs(keep, duplicates)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept, err := s.live(keep)
+	if err != nil {
+		return err
+	}
+	merged := make([]Transaction, len(ids))
+	for i, id := range ids {
+		if merged[i], err = s.live(id); err != nil {
+			return err
+		}
+	}
+
+	deletedAt := time.Now().Format("2006-01-02 15:04:05")
+	description := kept.Description
+	for _, t := range merged {
+		if description == "" {
+			description = t.Description
+		}
+		t.DeletedAt = deletedAt
+		t.Version++
+		s.transactions[t.ID] = t
+	}
+	if description != kept.Description {
+		kept.Description = description
+		kept.Version++
+		s.transactions[keep] = kept
+	}
+	return nil
+}
+
+func (s *MemoryStore) PatchTransactions(ctx context.Context, updates map[int]Transaction) (int64, error) {
+	for id, t := range updates {
+		if u, _ := transactionUpdates(t); len(u) == 0 {
+			return 0, invalidf("nothing to update for transaction #%d", id)
+		}
+		if err := ValidatePatch(t); err != nil {
+			return 0, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check everything before changing anything, so that a failure
+	// leaves the store as it was.
+	patched := make(map[int]Transaction, len(updates))
+	for id, t := range updates {
+		current, err := s.live(id)
+		if errors.Is(err, ErrNotFound) {
+			return 0, conflictf("transaction #%d no longer exists", id)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if t.Version != 0 && t.Version != current.Version {
+			return 0, staleVersion(id, t.Version, current.Version)
+		}
+		updated := mergeTransaction(current, t)
+		if err = ValidateTransaction(updated); err != nil {
+			return 0, err
+		}
+		updated.Version++
+		patched[id] = updated
+	}
+	for id, t := range patched {
+		s.transactions[id] = t
+	}
+	return int64(len(patched)), nil
+}
+
+// eachLive replaces every transaction in versions that bulkTarget picks
+// with fn's result and returns how many there were.
+func (s *MemoryStore) eachLive(versions map[int]int, fn func(Transaction) Transaction) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check everything before changing anything, so that a failure
+	// leaves the store as it was.
+	var targets []int
+	for id, expected := range versions {
+		current, found := s.transactions[id]
+		ok, err := bulkTarget(id, expected, current, found)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			targets = append(targets, id)
+		}
+	}
+	for _, id := range targets {
+		updated := fn(s.transactions[id])
+		updated.Version++
+		s.transactions[id] = updated
+	}
+	return int64(len(targets)), nil
+}
+
+func (s *MemoryStore) AddBudget(ctx context.Context, b Budget) error {
+	if err := ValidateBudget(b); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.budgetByCategory(b.Category); ok {
+		return conflictf("budget for this category already exists")
+	}
+	s.lastBudgetID++
+	b.ID = s.lastBudgetID
+	b.Version = 1
+	s.budgets[b.ID] = b
+	s.setAmount(BudgetAmount{Category: b.Category, Amount: b.Amount})
+	return nil
+}
+
+func (s *MemoryStore) UpdateBudget(ctx context.Context, category string, amount float64, effective string) error {
+	if err := validateBudgetAmount(amount, effective); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.budgetByCategory(category)
+	if !ok {
+		return notFoundf("no budget for category %q", category)
+	}
+	s.setAmount(BudgetAmount{Category: category, Amount: amount, EffectiveFrom: effective})
+	b.Amount = amountOn(s.amounts[category], b.Amount, time.Now().Format(dateLayout))
+	b.Version++
+	s.budgets[b.ID] = b
+	return nil
+}
+
+func (s *MemoryStore) setAmount(a BudgetAmount) {
+	amounts := s.amounts[a.Category]
+	for i := range amounts {
+		if amounts[i].EffectiveFrom == a.EffectiveFrom {
+			amounts[i].Amount = a.Amount
+			return
+		}
+	}
+	s.lastAmountID++
+	a.ID = s.lastAmountID
+	amounts = append(amounts, a)
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i].EffectiveFrom < amounts[j].EffectiveFrom })
+	s.amounts[a.Category] = amounts
+}
+
+func (s *MemoryStore) GetBudgetAmounts(ctx context.Context, category string) ([]BudgetAmount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]BudgetAmount(nil), s.amounts[category]...), nil
+}
+
+func (s *MemoryStore) budgetByCategory(category string) (Budget, bool) {
+	for _, b := range s.budgets {
+		if b.Category == category {
+			return b, true
+		}
+	}
+	return Budget{}, false
+}
+
+func (s *MemoryStore) GetBudgets(ctx context.Context) ([]Budget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var budgets []Budget
+	for _, b := range s.budgets {
+		budgets = append(budgets, s.current(b))
+	}
+	sort.Slice(budgets, func(i, j int) bool { return budgets[i].ID < budgets[j].ID })
+	return budgets, nil
+}
+
+func (s *MemoryStore) GetBudget(ctx context.Context, category string) (Budget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.budgetByCategory(category)
+	if !ok {
+		return Budget{}, notFoundf("no budget for category %q", category)
+	}
+	return s.current(b), nil
+}
+
+// current gives b the amount in force today, which changes without an
+// update once a change dated in the future takes effect.
+func (s *MemoryStore) current(b Budget) Budget {
+	b.Amount = amountOn(s.amounts[b.Category], b.Amount, time.Now().Format(dateLayout))
+	return b
+}
+
+func (s *MemoryStore) RemoveBudget(ctx context.Context, category string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.budgetByCategory(category); ok {
+		delete(s.budgets, b.ID)
+		delete(s.amounts, category)
+	}
+	return nil
+}
+
+func (s *MemoryStore) MoveMoney(ctx context.Context, m BudgetMove) (int, error) {
+	if err := validateMove(m); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, category := range []string{m.From, m.To} {
+		if _, ok := s.budgetByCategory(category); !ok {
+			return 0, notFoundf("no budget for category %q", category)
+		}
+	}
+	m.ID = len(s.moves) + 1
+	s.moves = append(s.moves, m)
+	return m.ID, nil
+}
+
+func (s *MemoryStore) GetBudgetMoves(ctx context.Context, r DateRange) ([]BudgetMove, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var moves []BudgetMove
+	for _, m := range s.moves {
+		if r.contains(m.Date) {
+			moves = append(moves, m)
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].Date < moves[j].Date })
+	return moves, nil
+}
+
+func (s *MemoryStore) AddGoal(ctx context.Context, g Goal) error {
+	if err := ValidateGoal(g); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.goals {
+		if existing.Name == g.Name {
+			return conflictf("goal %q already exists", g.Name)
+		}
+	}
+	s.lastGoalID++
+	g.ID = s.lastGoalID
+	g.Version = 1
+	s.goals = append(s.goals, g)
+	return nil
+}
+
+func (s *MemoryStore) GetGoals(ctx context.Context) ([]Goal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Goal(nil), s.goals...), nil
+}
+
+func (s *MemoryStore) GetGoal(ctx context.Context, name string) (Goal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, g := range s.goals {
+		if g.Name == name {
+			return g, nil
+		}
+	}
+	return Goal{}, notFoundf("no goal named %q", name)
+}
+
+func (s *MemoryStore) RemoveGoal(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, g := range s.goals {
+		if g.Name == name {
+			s.goals = append(s.goals[:i], s.goals[i+1:]...)
+			return nil
+		}
+	}
+	return notFoundf("no goal named %q", name)
+}
+
+func (s *MemoryStore) Assign(ctx context.Context, a Assignment) error {
+	if err := validateAssignment(a); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.assignments {
+		if existing.Month != a.Month || existing.Category != a.Category {
+			continue
+		}
+		if a.Amount == 0 {
+			s.assignments = append(s.assignments[:i], s.assignments[i+1:]...)
+		} else {
+			s.assignments[i].Amount = a.Amount
+		}
+		return nil
+	}
+	if a.Amount != 0 {
+		s.lastAssignmentID++
+		a.ID = s.lastAssignmentID
+		s.assignments = append(s.assignments, a)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetAssignments(ctx context.Context, month string) ([]Assignment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var assignments []Assignment
+	for _, a := range s.assignments {
+		if a.Month == month {
+			assignments = append(assignments, a)
+		}
+	}
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].Category < assignments[j].Category })
+	return assignments, nil
+}
+
+func (s *MemoryStore) RecordAlert(ctx context.Context, a Alert) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.alerts {
+		if existing.Category == a.Category && existing.Window.Start == a.Window.Start && existing.Threshold == a.Threshold {
+			return false, nil
+		}
+	}
+	a.ID = len(s.alerts) + 1
+	a.SentAt = time.Now().Format("2006-01-02 15:04:05")
+	s.alerts = append(s.alerts, a)
+	return true, nil
+}
+
+func (s *MemoryStore) GetAlerts(ctx context.Context, limit int) ([]Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var alerts []Alert
+	for i := len(s.alerts) - 1; i >= 0 && (limit <= 0 || len(alerts) < limit); i-- {
+		alerts = append(alerts, s.alerts[i])
+	}
+	return alerts, nil
+}
+
+func (s *MemoryStore) AddNotifier(ctx context.Context, c NotifierConfig) (int, error) {
+	if _, err := NewNotifier(c); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastNotifierID++
+	c.ID = s.lastNotifierID
+	s.notifiers = append(s.notifiers, c)
+	return c.ID, nil
+}
+
+func (s *MemoryStore) GetNotifiers(ctx context.Context) ([]NotifierConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]NotifierConfig(nil), s.notifiers...), nil
+}
+
+func (s *MemoryStore) RemoveNotifier(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, c := range s.notifiers {
+		if c.ID == id {
+			s.notifiers = append(s.notifiers[:i], s.notifiers[i+1:]...)
+			return nil
+		}
+	}
+	return notFoundf("notifier #%d not found", id)
+}
+
+func (s *MemoryStore) AddRule(ctx context.Context, r Rule) (int, error) {
+	if err := ValidateRule(r); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastRuleID++
+	r.ID = s.lastRuleID
+	r.Tags = JoinTags(r.Tags)
+	s.rules = append(s.rules, r)
+	return r.ID, nil
+}
+
+func (s *MemoryStore) GetRules(ctx context.Context) ([]Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Rule(nil), s.rules...), nil
+}
+
+func (s *MemoryStore) RemoveRule(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.rules {
+		if r.ID == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return nil
+		}
+	}
+	return notFoundf("rule #%d not found", id)
+}
+
+func (s *MemoryStore) inRange(r DateRange, where Filter) []Transaction {
+	var result []Transaction
+	for _, t := range s.transactions {
+		if t.DeletedAt == "" && r.contains(t.Date) && where.Match(t) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func (s *MemoryStore) GetBalance(ctx context.Context, r DateRange, where Filter) (income, expense float64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.inRange(r, where) {
+		switch t.Type {
+		case "income":
+			income += t.Amount
+		case "expense":
+			expense += t.Amount
+		}
+	}
+	return income, expense, nil
+}
+
+func (s *MemoryStore) GetCategoryStats(ctx context.Context, r DateRange, where Filter) (map[string]float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]float64)
+	for _, t := range s.inRange(r, where) {
+		if t.Type == "expense" {
+			stats[t.Category] += t.Amount
+		}
+	}
+	return stats, nil
+}
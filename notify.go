@@ -0,0 +1,257 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Notifier delivers budget alerts somewhere outside the terminal.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+const (
+	NotifierDesktop = "desktop"
+	NotifierSMTP    = "smtp"
+	NotifierWebhook = "webhook"
+	NotifierCommand = "command"
+)
+
+// notifyTimeout bounds how long a notifier that talks to a server may
+// hold up the command that triggered the alert.
+const notifyTimeout = 10 * time.Second
+
+// NotifierConfig is a stored notifier. Target is the recipients of smtp
+// (comma-separated), the URL of webhook and the shell command of command;
+// desktop has none. Server is the SMTP server, localhost:25 by default.
+type NotifierConfig struct {
+	ID     int
+	Kind   string
+	Target string
+	Server string
+}
+
+// NewNotifier builds the notifier c describes.
+func NewNotifier(c NotifierConfig) (Notifier, error) {
+	switch c.Kind {
+	case NotifierDesktop:
+		return DesktopNotifier{}, nil
+	case NotifierSMTP:
+		var to []string
+		for _, addr := range strings.Split(c.Target, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				to = append(to, addr)
+			}
+		}
+		if len(to) == 0 {
+			return nil, invalidf("smtp notifier needs at least one recipient")
+		}
+		server := c.Server
+		if server == "" {
+			server = "localhost:25"
+		}
+		return SMTPNotifier{Server: server, To: to}, nil
+	case NotifierWebhook:
+		u, err := url.Parse(c.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, invalidf("webhook notifier needs an http or https URL")
+		}
+		return WebhookNotifier{URL: c.Target}, nil
+	case NotifierCommand:
+		if strings.TrimSpace(c.Target) == "" {
+			return nil, invalidf("command notifier needs a command")
+		}
+		return CommandNotifier{Command: c.Target}, nil
+	default:
+		return nil, invalidf("invalid notifier %q, must be desktop, smtp, webhook or command", c.Kind)
+	}
+}
+
+// alertEnv describes a to commands as FINANCE_ALERT_* variables, so that
+// nothing has to be quoted into a command line.
+func alertEnv(a Alert) []string {
+	return append(os.Environ(),
+		"FINANCE_ALERT_TITLE="+a.Title(),
+		"FINANCE_ALERT_MESSAGE="+a.Message(),
+		"FINANCE_ALERT_CATEGORY="+a.Category,
+		"FINANCE_ALERT_THRESHOLD="+fmt.Sprint(a.Threshold),
+		fmt.Sprintf("FINANCE_ALERT_SPENT=%.2f", a.Spent),
+		fmt.Sprintf("FINANCE_ALERT_LIMIT=%.2f", a.Limit),
+		"FINANCE_ALERT_START="+a.Window.Start,
+		"FINANCE_ALERT_END="+a.Window.End,
+	)
+}
+
+func runAlertCommand(ctx context.Context, a Alert, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = alertEnv(a)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// DesktopNotifier shows a desktop notification with notify-send,
+// osascript or PowerShell, depending on the system.
+type DesktopNotifier struct{}
+
+func (DesktopNotifier) Notify(ctx context.Context, a Alert) error {
+	switch runtime.GOOS {
+	case "windows":
+		return runAlertCommand(ctx, a, "powershell", "-NoProfile", "-Command", `
+Add-Type -AssemblyName System.Windows.Forms
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Warning
+$n.Visible = $true
+$n.ShowBalloonTip(10000, $env:FINANCE_ALERT_TITLE, $env:FINANCE_ALERT_MESSAGE, 'Warning')
+Start-Sleep -Seconds 1
+$n.Dispose()`)
+	case "darwin":
+		return runAlertCommand(ctx, a, "osascript", "-e",
+			`display notification (system attribute "FINANCE_ALERT_MESSAGE") with title (system attribute "FINANCE_ALERT_TITLE")`)
+	default:
+		return runAlertCommand(ctx, a, "notify-send", a.Title(), a.Message())
+	}
+}
+
+// SMTPNotifier mails alerts through an SMTP server that accepts mail
+// without authentication, such as a local relay.
+type SMTPNotifier struct {
+	Server string
+	To     []string
+}
+
+func (n SMTPNotifier) Notify(ctx context.Context, a Alert) error {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	from := "finance@" + host
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", a.Title())
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", a.Message())
+
+	if err := n.send(ctx, from, msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp %s: %w", n.Server, err)
+	}
+	return nil
+}
+
+// send does what smtp.SendMail does, over a connection that gives up when
+// ctx is done or after notifyTimeout, so an unreachable server cannot hang
+// the command.
+func (n SMTPNotifier) send(ctx context.Context, from string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", n.Server)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(n.Server)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// WebhookNotifier POSTs alerts as JSON.
+type WebhookNotifier struct {
+	URL string
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(struct {
+		Title     string  `json:"title"`
+		Message   string  `json:"message"`
+		Category  string  `json:"category"`
+		Threshold float64 `json:"threshold"`
+		Spent     float64 `json:"spent"`
+		Limit     float64 `json:"limit"`
+		Start     string  `json:"start"`
+		End       string  `json:"end"`
+	}{a.Title(), a.Message(), a.Category, a.Threshold, a.Spent, a.Limit, a.Window.Start, a.Window.End})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: %s", n.URL, resp.Status)
+	}
+	return nil
+}
+
+// CommandNotifier runs a shell command with the alert in FINANCE_ALERT_*
+// environment variables: TITLE, MESSAGE, CATEGORY, THRESHOLD, SPENT,
+// LIMIT, START and END.
+type CommandNotifier struct {
+	Command string
+}
+
+func (n CommandNotifier) Notify(ctx context.Context, a Alert) error {
+	if runtime.GOOS == "windows" {
+		return runAlertCommand(ctx, a, "cmd", "/C", n.Command)
+	}
+	return runAlertCommand(ctx, a, "sh", "-c", n.Command)
+}
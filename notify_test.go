@@ -0,0 +1,152 @@
+package tracker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAlert = Alert{Category: "food", Window: DateRange{"2024-01-01", "2024-01-31"}, Threshold: 90, Spent: 95, Limit: 100}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(NotifierConfig{Kind: NotifierWebhook, Target: srv.URL + "/hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = n.Notify(t.Context(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+	if got["category"] != "food" || got["threshold"] != 90.0 || got["start"] != "2024-01-01" || got["message"] == "" {
+		t.Errorf("webhook body = %v", got)
+	}
+
+	if err = (WebhookNotifier{URL: srv.URL + "/fail"}).Notify(t.Context(), testAlert); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("failing webhook error = %v, want the 500 status", err)
+	}
+}
+
+func TestCommandNotifier(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "alert.txt")
+	n := CommandNotifier{Command: `printf '%s %s' "$FINANCE_ALERT_CATEGORY" "$FINANCE_ALERT_THRESHOLD" > ` + out}
+	if err := n.Notify(t.Context(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "food 90" {
+		t.Errorf("command saw %q, want %q", data, "food 90")
+	}
+
+	if err = (CommandNotifier{Command: "exit 3"}).Notify(t.Context(), testAlert); err == nil {
+		t.Error("failing command returned no error")
+	}
+}
+
+// fakeSMTP accepts one message and returns what was sent after DATA.
+func fakeSMTP(ln net.Listener, body chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 fake")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+		case "EHLO", "HELO", "MAIL", "RCPT":
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err = r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			body <- data.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("500 unknown")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	body := make(chan string, 1)
+	go fakeSMTP(ln, body)
+
+	n := SMTPNotifier{Server: ln.Addr().String(), To: []string{"me@example.com"}}
+	if err = n.Notify(t.Context(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-body; !strings.Contains(got, "Subject: "+testAlert.Title()) || !strings.Contains(got, testAlert.Message()) {
+		t.Errorf("mail = %q", got)
+	}
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	// The server accepts the connection but never greets.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			io.Copy(io.Discard, conn)
+			conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	n := SMTPNotifier{Server: ln.Addr().String(), To: []string{"me@example.com"}}
+	if err = n.Notify(ctx, testAlert); err == nil {
+		t.Fatal("silent server did not fail the notification")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Notify took %v with a 200ms deadline", elapsed)
+	}
+}
@@ -0,0 +1,171 @@
+package tracker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// DateRange is an inclusive range of YYYY-MM-DD dates. An empty bound is
+// open, so the zero value covers all time.
+type DateRange struct {
+	Start string
+	End   string
+}
+
+func (r DateRange) contains(date string) bool {
+	return (r.Start == "" || date >= r.Start) && (r.End == "" || date <= r.End)
+}
+
+// PeriodRange resolves a stats period (day, week, month, year, custom or
+// all) to the dates it covers as of now. Weeks run Monday to Sunday.
+func PeriodRange(period, startDate, endDate string, now time.Time) (DateRange, error) {
+	today := truncateDay(now)
+
+	switch period {
+	case "day":
+		return DateRange{today.Format(dateLayout), today.Format(dateLayout)}, nil
+	case "week":
+		return budgetPeriods["weekly"].containing(today, time.Time{}), nil
+	case "month":
+		return budgetPeriods["monthly"].containing(today, time.Time{}), nil
+	case "year":
+		return budgetPeriods["yearly"].containing(today, time.Time{}), nil
+	case "custom":
+		if startDate == "" || endDate == "" {
+			return DateRange{}, invalidf("start and end dates required for custom period")
+		}
+		return DateRange{startDate, endDate}, nil
+	default:
+		return DateRange{}, nil
+	}
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// budgetPeriod is the length of one budget period, in either days or
+// calendar months.
+type budgetPeriod struct {
+	days   int
+	months int
+}
+
+var budgetPeriods = map[string]budgetPeriod{
+	"weekly":    {days: 7},
+	"biweekly":  {days: 14},
+	"monthly":   {months: 1},
+	"quarterly": {months: 3},
+	"yearly":    {months: 12},
+}
+
+// parseBudgetPeriod accepts the named periods above and "<N>d" for periods
+// of N days.
+func parseBudgetPeriod(period string) (budgetPeriod, error) {
+	if p, ok := budgetPeriods[period]; ok {
+		return p, nil
+	}
+	if n, ok := strings.CutSuffix(period, "d"); ok {
+		if days, err := strconv.Atoi(n); err == nil && days > 0 {
+			return budgetPeriod{days: days}, nil
+		}
+	}
+	return budgetPeriod{}, invalidf("invalid period %q, must be weekly, biweekly, monthly, quarterly, yearly or a number of days such as 10d", period)
+}
+
+// Periods without an anchor line up with the calendar: day-based ones
+// count from a Monday, so weekly budgets run Monday to Sunday, and
+// month-based ones from January 1st, so quarters start in January, April,
+// July and October.
+var (
+	dayEpoch   = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+	monthEpoch = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// containing returns the period that contains date. Periods repeat from
+// anchor in both directions; a zero anchor means calendar alignment.
+func (p budgetPeriod) containing(date, anchor time.Time) DateRange {
+	var start, next time.Time
+	if p.days > 0 {
+		if anchor.IsZero() {
+			anchor = dayEpoch
+		}
+		offset := int(date.Sub(anchor).Hours()/24) / p.days
+		if date.Before(anchor.AddDate(0, 0, offset*p.days)) {
+			offset--
+		}
+		start = anchor.AddDate(0, 0, offset*p.days)
+		next = start.AddDate(0, 0, p.days)
+	} else {
+		if anchor.IsZero() {
+			anchor = monthEpoch
+		}
+		months := (date.Year()-anchor.Year())*12 + int(date.Month()-anchor.Month())
+		k := months / p.months
+		if months < 0 && months%p.months != 0 {
+			k--
+		}
+		for addMonths(anchor, k*p.months).After(date) {
+			k--
+		}
+		for !addMonths(anchor, (k+1)*p.months).After(date) {
+			k++
+		}
+		start = addMonths(anchor, k*p.months)
+		next = addMonths(anchor, (k+1)*p.months)
+	}
+	return DateRange{start.Format(dateLayout), next.AddDate(0, 0, -1).Format(dateLayout)}
+}
+
+// add moves t by n periods.
+func (p budgetPeriod) add(t time.Time, n int) time.Time {
+	if p.days > 0 {
+		return t.AddDate(0, 0, n*p.days)
+	}
+	return addMonths(t, n*p.months)
+}
+
+// addMonths moves t by n calendar months, keeping the day of month where
+// possible and using the last day of shorter months instead of spilling
+// over, so periods anchored on the 31st end on the 30th of April.
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// BudgetWindow returns the period of b that contains date, clipped to the
+// budget's StartDate and EndDate. ok is false when the budget is not active
+// on date.
+func BudgetWindow(b Budget, date time.Time) (r DateRange, ok bool) {
+	day := truncateDay(date).Format(dateLayout)
+	if !(DateRange{b.StartDate, b.EndDate}).contains(day) {
+		return DateRange{}, false
+	}
+	p, err := parseBudgetPeriod(b.Period)
+	if err != nil {
+		return DateRange{}, false
+	}
+	var anchor time.Time
+	if b.Anchor != "" {
+		if anchor, err = time.Parse(dateLayout, b.Anchor); err != nil {
+			return DateRange{}, false
+		}
+	}
+
+	r = p.containing(truncateDay(date), anchor)
+	if b.StartDate > r.Start {
+		r.Start = b.StartDate
+	}
+	if b.EndDate != "" && b.EndDate < r.End {
+		r.End = b.EndDate
+	}
+	return r, true
+}
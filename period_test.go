@@ -0,0 +1,52 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudgetWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget Budget
+		date   string
+		want   DateRange
+		ok     bool
+	}{
+		{"weekly starts monday", Budget{Period: "weekly"}, "2026-10-18", DateRange{"2026-10-12", "2026-10-18"}, true},
+		{"weekly on monday", Budget{Period: "weekly"}, "2026-10-19", DateRange{"2026-10-19", "2026-10-25"}, true},
+		{"weekly anchored", Budget{Period: "weekly", Anchor: "2026-10-03"}, "2026-10-18", DateRange{"2026-10-17", "2026-10-23"}, true},
+		{"biweekly before anchor", Budget{Period: "biweekly", Anchor: "2026-10-05"}, "2026-09-30", DateRange{"2026-09-21", "2026-10-04"}, true},
+		{"days", Budget{Period: "10d", Anchor: "2026-01-01"}, "2026-01-25", DateRange{"2026-01-21", "2026-01-30"}, true},
+		{"monthly", Budget{Period: "monthly"}, "2026-02-14", DateRange{"2026-02-01", "2026-02-28"}, true},
+		{"monthly anchored", Budget{Period: "monthly", Anchor: "2026-01-15"}, "2026-03-02", DateRange{"2026-02-15", "2026-03-14"}, true},
+		{"monthly anchored on the 31st", Budget{Period: "monthly", Anchor: "2026-01-31"}, "2026-04-30", DateRange{"2026-04-30", "2026-05-30"}, true},
+		{"quarterly", Budget{Period: "quarterly"}, "2026-05-20", DateRange{"2026-04-01", "2026-06-30"}, true},
+		{"quarterly anchored before", Budget{Period: "quarterly", Anchor: "2026-02-01"}, "2025-12-31", DateRange{"2025-11-01", "2026-01-31"}, true},
+		{"yearly", Budget{Period: "yearly"}, "2026-10-18", DateRange{"2026-01-01", "2026-12-31"}, true},
+		{"clipped to start", Budget{Period: "monthly", StartDate: "2026-10-10"}, "2026-10-18", DateRange{"2026-10-10", "2026-10-31"}, true},
+		{"clipped to end", Budget{Period: "monthly", StartDate: "2026-01-01", EndDate: "2026-10-20"}, "2026-10-18", DateRange{"2026-10-01", "2026-10-20"}, true},
+		{"not started", Budget{Period: "monthly", StartDate: "2026-11-01"}, "2026-10-18", DateRange{}, false},
+		{"ended", Budget{Period: "monthly", StartDate: "2026-01-01", EndDate: "2026-09-30"}, "2026-10-18", DateRange{}, false},
+	}
+	for _, tt := range tests {
+		date, _ := time.Parse(dateLayout, tt.date)
+		got, ok := BudgetWindow(tt.budget, date)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: BudgetWindow = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPeriodRangeWeek(t *testing.T) {
+	for date, want := range map[string]DateRange{
+		"2026-10-18": {"2026-10-12", "2026-10-18"}, // Sunday
+		"2026-10-19": {"2026-10-19", "2026-10-25"}, // Monday
+	} {
+		now, _ := time.Parse(dateLayout, date)
+		got, err := PeriodRange("week", "", "", now)
+		if err != nil || got != want {
+			t.Errorf("week of %s = %v, %v, want %v", date, got, err, want)
+		}
+	}
+}
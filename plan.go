@@ -0,0 +1,160 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const monthLayout = "2006-01"
+
+// Assignment is the part of a month's income given to one category in
+// zero-based budgeting.
+type Assignment struct {
+	ID       int
+	Month    string
+	Category string
+	Amount   float64
+}
+
+// Plan is a zero-based budget for one month: every unit of the month's
+// income should be assigned to a category, leaving ToBeAssigned at zero.
+// A month is planned once anything has been assigned in it.
+type Plan struct {
+	Month        string
+	Income       float64
+	Assigned     float64
+	ToBeAssigned float64
+	Assignments  []Assignment
+	// Spent is the month's spending per assigned category.
+	Spent map[string]float64
+}
+
+// Planned reports whether the month uses zero-based budgeting.
+func (p Plan) Planned() bool {
+	return len(p.Assignments) > 0
+}
+
+// MonthRange returns the dates of a YYYY-MM month.
+func MonthRange(month string) (DateRange, error) {
+	start, err := time.Parse(monthLayout, month)
+	if err != nil {
+		return DateRange{}, invalidf("invalid month format, use YYYY-MM")
+	}
+	return DateRange{start.Format(dateLayout), start.AddDate(0, 1, -1).Format(dateLayout)}, nil
+}
+
+func validateAssignment(a Assignment) error {
+	if a.Category == "" {
+		return invalidf("category is required")
+	}
+	if a.Amount < 0 {
+		return invalidf("amount cannot be negative")
+	}
+	_, err := MonthRange(a.Month)
+	return err
+}
+
+// MonthPlan puts the assignments of month next to its income from
+// GetBalance and its spending.
+func MonthPlan(ctx context.Context, s Store, month string) (Plan, error) {
+	r, err := MonthRange(month)
+	if err != nil {
+		return Plan{}, err
+	}
+	p := Plan{Month: month, Spent: make(map[string]float64)}
+	if p.Assignments, err = s.GetAssignments(ctx, month); err != nil {
+		return Plan{}, err
+	}
+	if p.Income, _, err = s.GetBalance(ctx, r, Filter{}); err != nil {
+		return Plan{}, err
+	}
+	stats, err := s.GetCategoryStats(ctx, r, Filter{})
+	if err != nil {
+		return Plan{}, err
+	}
+	for _, a := range p.Assignments {
+		p.Assigned += a.Amount
+		p.Spent[a.Category] = stats[a.Category]
+	}
+	p.ToBeAssigned = p.Income - p.Assigned
+	return p, nil
+}
+
+func createAssignmentsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS assignments (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        month TEXT NOT NULL,
+        category TEXT NOT NULL,
+        amount REAL NOT NULL,
+        UNIQUE (month, category)
+    );`)
+	return err
+}
+
+// Assign sets what is assigned to a category in a month. Assigning zero
+// removes the assignment.
+func (s *SQLiteStore) Assign(ctx context.Context, a Assignment) error {
+	if err := validateAssignment(a); err != nil {
+		return err
+	}
+
+	return s.withJournal(ctx, func(j *journal) error {
+		var before Assignment
+		err := j.tx.QueryRowContext(ctx, "SELECT id, month, category, amount FROM assignments WHERE month = ? AND category = ?", a.Month, a.Category).
+			Scan(&before.ID, &before.Month, &before.Category, &before.Amount)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if a.Amount == 0 {
+				return nil
+			}
+			res, err := j.tx.ExecContext(ctx, "INSERT INTO assignments (month, category, amount) VALUES (?, ?, ?)", a.Month, a.Category, a.Amount)
+			if err != nil {
+				return err
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			a.ID = int(id)
+			return j.record("create", "assignments", a.ID, nil, &a)
+		case err != nil:
+			return err
+		case a.Amount == 0:
+			if _, err = j.tx.ExecContext(ctx, "DELETE FROM assignments WHERE id = ?", before.ID); err != nil {
+				return err
+			}
+			return j.record("delete", "assignments", before.ID, &before, nil)
+		default:
+			a.ID = before.ID
+			if _, err = j.tx.ExecContext(ctx, "UPDATE assignments SET amount = ? WHERE id = ?", a.Amount, a.ID); err != nil {
+				return err
+			}
+			return j.record("update", "assignments", a.ID, &before, &a)
+		}
+	})
+}
+
+func (s *SQLiteStore) GetAssignments(ctx context.Context, month string) ([]Assignment, error) {
+	return getAssignments(ctx, s.db, "SELECT id, month, category, amount FROM assignments WHERE month = ? ORDER BY category", month)
+}
+
+func getAssignments(ctx context.Context, q querier, query string, args ...interface{}) ([]Assignment, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assignments []Assignment
+	for rows.Next() {
+		var a Assignment
+		if err = rows.Scan(&a.ID, &a.Month, &a.Category, &a.Amount); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
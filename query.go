@@ -0,0 +1,482 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter is a parsed -where expression such as
+//
+//	amount > 100 and category in (food, shopping) and desc ~ "coffee"
+//
+// It compiles to a parameterized SQL condition; values never end up in the
+// query text. Stores that do not speak SQL evaluate it with Match instead.
+type Filter struct {
+	root filterNode
+}
+
+type fieldKind int
+
+const (
+	fieldNumber fieldKind = iota
+	fieldText
+	fieldDate
+)
+
+type filterField struct {
+	column string
+	kind   fieldKind
+}
+
+var filterFields = map[string]filterField{
+	"id":          {"id", fieldNumber},
+	"type":        {"type", fieldText},
+	"category":    {"category", fieldText},
+	"amount":      {"amount", fieldNumber},
+	"desc":        {"COALESCE(description, '')", fieldText},
+	"description": {"COALESCE(description, '')", fieldText},
+	"date":        {"date", fieldDate},
+}
+
+// value returns the field of t the way SQLite would see the column.
+func (f filterField) value(t Transaction) interface{} {
+	switch f.column {
+	case "id":
+		return float64(t.ID)
+	case "type":
+		return t.Type
+	case "category":
+		return t.Category
+	case "amount":
+		return t.Amount
+	case "date":
+		return t.Date
+	default:
+		return t.Description
+	}
+}
+
+type filterNode interface {
+	sql(args *[]interface{}) string
+	match(t Transaction) bool
+}
+
+type logicalNode struct {
+	op          string
+	left, right filterNode
+}
+
+type notNode struct {
+	operand filterNode
+}
+
+type compareNode struct {
+	field  filterField
+	op     string
+	values []interface{}
+}
+
+func (n logicalNode) sql(args *[]interface{}) string {
+	return "(" + n.left.sql(args) + " " + n.op + " " + n.right.sql(args) + ")"
+}
+
+func (n notNode) sql(args *[]interface{}) string {
+	return "NOT " + n.operand.sql(args)
+}
+
+func (n compareNode) sql(args *[]interface{}) string {
+	switch n.op {
+	case "in", "not in":
+		placeholders := make([]string, len(n.values))
+		for i, v := range n.values {
+			placeholders[i] = "?"
+			*args = append(*args, v)
+		}
+		op := "IN"
+		if n.op == "not in" {
+			op = "NOT IN"
+		}
+		return fmt.Sprintf("%s %s (%s)", n.field.column, op, strings.Join(placeholders, ", "))
+	case "~", "!~":
+		*args = append(*args, "%"+escapeLike(n.values[0].(string))+"%")
+		op := "LIKE"
+		if n.op == "!~" {
+			op = "NOT LIKE"
+		}
+		return fmt.Sprintf("%s %s ? ESCAPE '\\'", n.field.column, op)
+	default:
+		*args = append(*args, n.values[0])
+		return fmt.Sprintf("%s %s ?", n.field.column, n.op)
+	}
+}
+
+func (n logicalNode) match(t Transaction) bool {
+	if n.op == "AND" {
+		return n.left.match(t) && n.right.match(t)
+	}
+	return n.left.match(t) || n.right.match(t)
+}
+
+func (n notNode) match(t Transaction) bool {
+	return !n.operand.match(t)
+}
+
+func (n compareNode) match(t Transaction) bool {
+	value := n.field.value(t)
+	switch n.op {
+	case "in", "not in":
+		found := false
+		for _, v := range n.values {
+			if compareValues(value, v) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in")
+	case "~", "!~":
+		found := strings.Contains(foldASCII(value.(string)), foldASCII(n.values[0].(string)))
+		return found == (n.op == "~")
+	}
+
+	c := compareValues(value, n.values[0])
+	switch n.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func compareValues(a, b interface{}) int {
+	if x, ok := a.(float64); ok {
+		y := b.(float64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+// foldASCII lowercases ASCII letters only, matching SQLite's LIKE, which is
+// case-insensitive for ASCII and case-sensitive for everything else.
+func foldASCII(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// IsEmpty reports whether the filter has no conditions.
+func (f Filter) IsEmpty() bool {
+	return f.root == nil
+}
+
+// Match reports whether t satisfies the filter.
+func (f Filter) Match(t Transaction) bool {
+	return f.root == nil || f.root.match(t)
+}
+
+// clause returns the SQL condition and its arguments, or an empty string
+// when the filter matches everything.
+func (f Filter) clause() (string, []interface{}) {
+	if f.root == nil {
+		return "", nil
+	}
+	var args []interface{}
+	return f.root.sql(&args), args
+}
+
+// ParseFilter parses a -where expression. An empty expression yields an
+// empty filter. Syntax errors match ErrValidation.
+func ParseFilter(expr string) (Filter, error) {
+	f, err := parseFilter(expr)
+	if err != nil {
+		return Filter{}, &kindError{ErrValidation, err.Error()}
+	}
+	return f, nil
+}
+
+func parseFilter(expr string) (Filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return Filter{}, err
+	}
+	if len(tokens) == 0 {
+		return Filter{}, nil
+	}
+
+	p := &filterParser{tokens: tokens, end: len([]rune(expr))}
+	root, err := p.parseOr()
+	if err != nil {
+		return Filter{}, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return Filter{}, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos+1)
+	}
+	return Filter{root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{tokenLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{tokenRParen, ")", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, filterToken{tokenComma, ",", i})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start+1)
+			}
+			i++
+			tokens = append(tokens, filterToken{tokenString, sb.String(), start})
+		case strings.ContainsRune("=!<>~", r):
+			start := i
+			for i < len(runes) && strings.ContainsRune("=!<>~", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenOp, string(runes[start:i]), start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`(),"'=!<>~`, runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenWord, string(runes[start:i]), start})
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	end    int
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.pos >= len(p.tokens) {
+		return filterToken{kind: tokenEOF, text: "end of expression", pos: p.end}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.peek()
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) keyword(word string) bool {
+	tok := p.peek()
+	if tok.kind == tokenWord && strings.EqualFold(tok.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{"OR", left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{"AND", left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.keyword("not") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+	if p.peek().kind == tokenLParen {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ')' at position %d, got %q", tok.pos+1, tok.text)
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	tok := p.next()
+	if tok.kind != tokenWord {
+		return nil, fmt.Errorf("expected field name at position %d, got %q", tok.pos+1, tok.text)
+	}
+	field, ok := filterFields[strings.ToLower(tok.text)]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q, use one of: id, type, category, amount, desc, date", tok.text)
+	}
+
+	if p.keyword("in") {
+		return p.parseList(field, "in")
+	}
+	if p.keyword("not") {
+		if !p.keyword("in") {
+			return nil, fmt.Errorf("expected 'in' after 'not' at position %d", p.peek().pos+1)
+		}
+		return p.parseList(field, "not in")
+	}
+
+	opTok := p.next()
+	if opTok.kind != tokenOp {
+		return nil, fmt.Errorf("expected operator after %q at position %d, got %q", tok.text, opTok.pos+1, opTok.text)
+	}
+	op := opTok.text
+	switch op {
+	case "==":
+		op = "="
+	case "<>":
+		op = "!="
+	case "=", "!=", "<", "<=", ">", ">=":
+	case "~", "!~":
+		if field.kind != fieldText {
+			return nil, fmt.Errorf("operator %s only applies to text fields", op)
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q at position %d", op, opTok.pos+1)
+	}
+
+	value, err := p.parseValue(field)
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{field: field, op: op, values: []interface{}{value}}, nil
+}
+
+func (p *filterParser) parseList(field filterField, op string) (filterNode, error) {
+	if tok := p.next(); tok.kind != tokenLParen {
+		return nil, fmt.Errorf("expected '(' at position %d, got %q", tok.pos+1, tok.text)
+	}
+	var values []interface{}
+	for {
+		value, err := p.parseValue(field)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		tok := p.next()
+		if tok.kind == tokenRParen {
+			break
+		}
+		if tok.kind != tokenComma {
+			return nil, fmt.Errorf("expected ',' or ')' at position %d, got %q", tok.pos+1, tok.text)
+		}
+	}
+	return compareNode{field: field, op: op, values: values}, nil
+}
+
+func (p *filterParser) parseValue(field filterField) (interface{}, error) {
+	tok := p.next()
+	if tok.kind != tokenWord && tok.kind != tokenString {
+		return nil, fmt.Errorf("expected value at position %d, got %q", tok.pos+1, tok.text)
+	}
+
+	switch field.kind {
+	case fieldNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos+1)
+		}
+		return n, nil
+	case fieldDate:
+		if _, err := time.Parse("2006-01-02", tok.text); err != nil {
+			return nil, fmt.Errorf("invalid date %q at position %d, use YYYY-MM-DD", tok.text, tok.pos+1)
+		}
+		return tok.text, nil
+	default:
+		return tok.text, nil
+	}
+}
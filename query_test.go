@@ -0,0 +1,67 @@
+package tracker
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"amount >",
+		"amount > abc",
+		"amount > NaN",
+		"amount < -Inf",
+		"amount = +infinity",
+		"id in (1, nan)",
+		"payee = x",
+		"date >= 2024-13-01",
+		"amount ~ 5",
+		`desc ~ "coffee`,
+		"(amount > 1",
+		"category in (food, shopping",
+		"category not food",
+		"amount > 1 amount < 5",
+		"type === income",
+	} {
+		if _, err := ParseFilter(expr); !errors.Is(err, ErrValidation) {
+			t.Errorf("ParseFilter(%q) error = %v, want ErrValidation", expr, err)
+		}
+	}
+	if f, err := ParseFilter("  "); err != nil || !f.IsEmpty() {
+		t.Errorf("ParseFilter of blanks = %+v, %v, want an empty filter", f, err)
+	}
+}
+
+func TestFilterClause(t *testing.T) {
+	tests := []struct {
+		expr string
+		sql  string
+		args []interface{}
+	}{
+		{"amount > 100", "amount > ?", []interface{}{100.0}},
+		{"Category IN (food, 'eating out')", "category IN (?, ?)", []interface{}{"food", "eating out"}},
+		{`desc ~ "50%_off\\"`, `COALESCE(description, '') LIKE ? ESCAPE '\'`, []interface{}{`%50\%\_off\\%`}},
+		{"not type = income or date <> 2024-01-01", "(NOT type = ? OR date != ?)", []interface{}{"income", "2024-01-01"}},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", tt.expr, err)
+		}
+		sql, args := f.clause()
+		if sql != tt.sql || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: clause = %q %v, want %q %v", tt.expr, sql, args, tt.sql, tt.args)
+		}
+	}
+
+	// Values are passed as arguments, never spliced into the query.
+	f, err := ParseFilter(`category = "x'; DROP TABLE transactions; --"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql, args := f.clause(); strings.Contains(sql, "DROP") || len(args) != 1 {
+		t.Errorf("clause = %q %v", sql, args)
+	}
+}
@@ -0,0 +1,232 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Rule categorizes and cleans up transactions automatically. A transaction
+// matches when it meets every condition that is set: Pattern is a regular
+// expression searched for in the description, Payee must equal the whole
+// description ignoring case, and MinAmount and MaxAmount bound the amount
+// (zero means no bound). A matching transaction gets Category, Tags are
+// added to its own, and its description becomes Rewrite, in which $1 or
+// ${name} stand for groups of Pattern. The first matching rule, in the
+// order they were added, wins.
+type Rule struct {
+	ID        int
+	Type      string
+	Pattern   string
+	Payee     string
+	MinAmount float64
+	MaxAmount float64
+	Category  string
+	Tags      string
+	Rewrite   string
+}
+
+func ValidateRule(r Rule) error {
+	if r.Pattern == "" && r.Payee == "" && r.MinAmount == 0 && r.MaxAmount == 0 {
+		return invalidf("rule needs a pattern, payee or amount range to match on")
+	}
+	if r.Category == "" && JoinTags(r.Tags) == "" && r.Rewrite == "" {
+		return invalidf("rule needs a category, tags or description rewrite to assign")
+	}
+	if r.Type != "" && r.Type != "income" && r.Type != "expense" {
+		return invalidf("type must be 'income' or 'expense'")
+	}
+	if r.MinAmount < 0 || r.MaxAmount < 0 {
+		return invalidf("amounts cannot be negative")
+	}
+	if r.MaxAmount != 0 && r.MinAmount > r.MaxAmount {
+		return invalidf("minimum amount is above the maximum")
+	}
+	if _, err := regexp.Compile(r.Pattern); err != nil {
+		return invalidf("invalid pattern: %v", err)
+	}
+	return nil
+}
+
+// apply returns t changed by r and whether r matched it at all. Rules are
+// validated before they are stored, so the pattern compiles.
+func (r Rule) apply(t Transaction) (Transaction, bool) {
+	if r.Type != "" && t.Type != r.Type {
+		return t, false
+	}
+	if (r.MinAmount != 0 && t.Amount < r.MinAmount) || (r.MaxAmount != 0 && t.Amount > r.MaxAmount) {
+		return t, false
+	}
+	if r.Payee != "" && !strings.EqualFold(strings.TrimSpace(t.Description), strings.TrimSpace(r.Payee)) {
+		return t, false
+	}
+	re := regexp.MustCompile(r.Pattern)
+	match := re.FindStringSubmatchIndex(t.Description)
+	if match == nil {
+		return t, false
+	}
+
+	if r.Category != "" {
+		t.Category = r.Category
+	}
+	if r.Tags != "" {
+		t.Tags = JoinTags(t.Tags, r.Tags)
+	}
+	if r.Rewrite != "" {
+		if rewritten := string(re.ExpandString(nil, r.Rewrite, t.Description, match)); rewritten != "" {
+			t.Description = rewritten
+		}
+	}
+	return t, true
+}
+
+// ApplyRules runs t through rules and returns it as the first matching
+// rule leaves it, with that rule's id, or unchanged with 0.
+func ApplyRules(rules []Rule, t Transaction) (Transaction, int) {
+	for _, r := range rules {
+		if changed, ok := r.apply(t); ok {
+			return changed, r.ID
+		}
+	}
+	return t, 0
+}
+
+// RuleChange is what re-applying the rules would do to one transaction.
+type RuleChange struct {
+	RuleID int
+	Before Transaction
+	After  Transaction
+}
+
+// PreviewRules returns the changes the rules would make to the
+// transactions f selects, leaving out those they would not change.
+func PreviewRules(ctx context.Context, s Store, f TransactionFilter) ([]RuleChange, error) {
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.GetTransactions(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	var changes []RuleChange
+	for _, t := range transactions {
+		after, id := ApplyRules(rules, t)
+		if after != t {
+			changes = append(changes, RuleChange{RuleID: id, Before: t, After: after})
+		}
+	}
+	return changes, nil
+}
+
+// ApplyRuleChanges makes the changes of a preview, as one operation. It
+// changes nothing and fails with ErrConflict if any of the transactions
+// changed, went to the trash or was deleted since.
+func ApplyRuleChanges(ctx context.Context, s Store, changes []RuleChange) (int64, error) {
+	patches := make(map[int]Transaction, len(changes))
+	for _, c := range changes {
+		patch := Transaction{Amount: -1, Version: c.Before.Version}
+		if c.After.Category != c.Before.Category {
+			patch.Category = c.After.Category
+		}
+		if c.After.Tags != c.Before.Tags {
+			patch.Tags = c.After.Tags
+		}
+		if c.After.Description != c.Before.Description {
+			patch.Description = c.After.Description
+		}
+		patches[c.Before.ID] = patch
+	}
+	return s.PatchTransactions(ctx, patches)
+}
+
+func createRulesTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS rules (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        type TEXT,
+        pattern TEXT,
+        payee TEXT,
+        min_amount REAL NOT NULL DEFAULT 0,
+        max_amount REAL NOT NULL DEFAULT 0,
+        category TEXT,
+        rewrite TEXT,
+        tags TEXT
+    );`)
+	return err
+}
+
+const ruleColumns = "id, COALESCE(type, ''), COALESCE(pattern, ''), COALESCE(payee, ''), min_amount, max_amount, COALESCE(category, ''), COALESCE(tags, ''), COALESCE(rewrite, '')"
+
+func scanRule(row interface{ Scan(...interface{}) error }) (Rule, error) {
+	var r Rule
+	err := row.Scan(&r.ID, &r.Type, &r.Pattern, &r.Payee, &r.MinAmount, &r.MaxAmount, &r.Category, &r.Tags, &r.Rewrite)
+	return r, err
+}
+
+func (s *SQLiteStore) AddRule(ctx context.Context, r Rule) (int, error) {
+	if err := ValidateRule(r); err != nil {
+		return 0, err
+	}
+	r.Tags = JoinTags(r.Tags)
+
+	err := s.withJournal(ctx, func(j *journal) error {
+		res, err := j.tx.ExecContext(ctx, `
+            INSERT INTO rules (type, pattern, payee, min_amount, max_amount, category, tags, rewrite)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.Type, r.Pattern, r.Payee, r.MinAmount, r.MaxAmount, r.Category, r.Tags, r.Rewrite)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		r.ID = int(id)
+		return j.record("create", "rules", r.ID, nil, &r)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return r.ID, nil
+}
+
+func (s *SQLiteStore) GetRules(ctx context.Context) ([]Rule, error) {
+	return getRules(ctx, s.db)
+}
+
+func getRules(ctx context.Context, q querier) ([]Rule, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+ruleColumns+" FROM rules ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func (s *SQLiteStore) RemoveRule(ctx context.Context, id int) error {
+	return s.withJournal(ctx, func(j *journal) error {
+		r, err := scanRule(j.tx.QueryRowContext(ctx, "SELECT "+ruleColumns+" FROM rules WHERE id = ?", id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return notFoundf("rule #%d not found", id)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = j.tx.ExecContext(ctx, "DELETE FROM rules WHERE id = ?", id); err != nil {
+			return err
+		}
+		return j.record("delete", "rules", id, &r, nil)
+	})
+}
@@ -0,0 +1,206 @@
+package tracker
+
+import (
+	"context"
+	"time"
+)
+
+// Store is the storage behind the tracker: transactions, budgets and the
+// statistics computed over them. SQLiteStore is the persistent one;
+// MemoryStore keeps everything in maps and is meant for tests and for
+// embedding.
+//
+// Trashed transactions are invisible to everything except GetTransaction,
+// GetTransactions with Trashed set, and RestoreTransaction.
+type Store interface {
+	AddTransaction(ctx context.Context, t Transaction) (int, error)
+	GetTransaction(ctx context.Context, id int) (Transaction, error)
+	GetTransactions(ctx context.Context, f TransactionFilter) ([]Transaction, error)
+	GetTransactionTotals(ctx context.Context, f TransactionFilter) (TransactionTotals, error)
+	// UpdateTransaction applies the non-empty fields of t and validates the
+	// result as a whole; an Amount of 0 or -1 leaves the amount unchanged.
+	// It fails with ErrNotFound for missing and ErrConflict for trashed
+	// transactions, and with ErrConflict when t.Version is set and the
+	// transaction has since moved on to another version.
+	UpdateTransaction(ctx context.Context, id int, t Transaction) error
+	// DeleteTransaction moves a transaction to the trash, with the same
+	// errors as UpdateTransaction.
+	DeleteTransaction(ctx context.Context, id int) error
+	// RestoreTransaction fails with ErrConflict if the transaction is not
+	// in the trash.
+	RestoreTransaction(ctx context.Context, id int) error
+	// The bulk operations take the ids to change, each with the version
+	// it was seen at, and return how many were changed. Transactions given
+	// version 0 are skipped when missing or trashed; for the others the
+	// operation changes nothing and fails with ErrConflict if any of them
+	// is missing, in the trash or at another version.
+	BulkUpdateTransactions(ctx context.Context, versions map[int]int, t Transaction) (int64, error)
+	BulkDeleteTransactions(ctx context.Context, versions map[int]int) (int64, error)
+	// MergeTransactions keeps one of a set of duplicates and moves the
+	// others to the trash. The kept transaction takes the description of
+	// the first duplicate that has one if it has none itself. All of them
+	// must exist and be out of the trash.
+	MergeTransactions(ctx context.Context, keep int, duplicates []int) error
+	// PatchTransactions applies each update like UpdateTransaction to the
+	// transaction with its id, all at once, and returns how many were
+	// changed. It changes nothing and fails with ErrConflict if any of the
+	// transactions is missing, in the trash or at another version.
+	PatchTransactions(ctx context.Context, updates map[int]Transaction) (int64, error)
+
+	AddBudget(ctx context.Context, b Budget) error
+	GetBudgets(ctx context.Context) ([]Budget, error)
+	GetBudget(ctx context.Context, category string) (Budget, error)
+	RemoveBudget(ctx context.Context, category string) error
+	// UpdateBudget sets the limit of a budget to amount from the date
+	// effective on, keeping earlier periods at the limit they had. Setting
+	// a limit again for the same date replaces it.
+	UpdateBudget(ctx context.Context, category string, amount float64, effective string) error
+	// GetBudgetAmounts returns the history of a budget's limit, oldest
+	// first.
+	GetBudgetAmounts(ctx context.Context, category string) ([]BudgetAmount, error)
+	// MoveMoney records a move between the envelopes of two existing
+	// budgets and returns its id.
+	MoveMoney(ctx context.Context, m BudgetMove) (int, error)
+	GetBudgetMoves(ctx context.Context, r DateRange) ([]BudgetMove, error)
+
+	AddGoal(ctx context.Context, g Goal) error
+	GetGoals(ctx context.Context) ([]Goal, error)
+	GetGoal(ctx context.Context, name string) (Goal, error)
+	RemoveGoal(ctx context.Context, name string) error
+
+	// Assign sets what is assigned to a category in a month for zero-based
+	// budgeting; zero removes the assignment.
+	Assign(ctx context.Context, a Assignment) error
+	GetAssignments(ctx context.Context, month string) ([]Assignment, error)
+
+	// RecordAlert stores a as sent and reports false, storing nothing, when
+	// its threshold was already recorded for the same category and period.
+	RecordAlert(ctx context.Context, a Alert) (bool, error)
+	// GetAlerts returns sent alerts, newest first. A limit of 0 returns all.
+	GetAlerts(ctx context.Context, limit int) ([]Alert, error)
+	AddNotifier(ctx context.Context, c NotifierConfig) (int, error)
+	GetNotifiers(ctx context.Context) ([]NotifierConfig, error)
+	RemoveNotifier(ctx context.Context, id int) error
+
+	// AddRule stores a categorization rule after the existing ones and
+	// returns its id.
+	AddRule(ctx context.Context, r Rule) (int, error)
+	// GetRules returns the rules in the order they apply.
+	GetRules(ctx context.Context) ([]Rule, error)
+	RemoveRule(ctx context.Context, id int) error
+
+	GetBalance(ctx context.Context, r DateRange, where Filter) (income, expense float64, err error)
+	GetCategoryStats(ctx context.Context, r DateRange, where Filter) (map[string]float64, error)
+}
+
+var (
+	_ Store = (*SQLiteStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// BudgetStatus is a budget evaluated over the period containing one date.
+type BudgetStatus struct {
+	Budget Budget
+	// Window is the exact range of dates that was evaluated: the budget
+	// period containing the date, clipped to StartDate and EndDate.
+	Window DateRange
+	// Active is false when the date lies outside StartDate and EndDate.
+	// Window and Spent are empty then.
+	Active bool
+	// Limit is the budget amount that was in force on the last day of
+	// Window, which may differ from Budget.Amount for past periods.
+	Limit float64
+	Spent float64
+}
+
+// Ratio is the share of the limit that has been spent.
+func (st BudgetStatus) Ratio() float64 {
+	if st.Limit == 0 {
+		return 0
+	}
+	return st.Spent / st.Limit
+}
+
+// amountOn returns the limit in force on date given the history of a
+// budget, or fallback when the history is empty.
+func amountOn(amounts []BudgetAmount, fallback float64, date string) float64 {
+	for _, a := range amounts {
+		if a.EffectiveFrom > date {
+			break
+		}
+		fallback = a.Amount
+	}
+	return fallback
+}
+
+// CheckBudget evaluates the budget for category over its period that
+// contains date. It fails with ErrNotFound when there is no such budget.
+func CheckBudget(ctx context.Context, s Store, category string, date time.Time) (BudgetStatus, error) {
+	b, err := s.GetBudget(ctx, category)
+	if err != nil {
+		return BudgetStatus{}, err
+	}
+	return EvaluateBudget(ctx, s, b, date)
+}
+
+// EvaluateBudget is CheckBudget for a budget that was already loaded.
+func EvaluateBudget(ctx context.Context, s Store, b Budget, date time.Time) (BudgetStatus, error) {
+	amounts, err := s.GetBudgetAmounts(ctx, b.Category)
+	if err != nil {
+		return BudgetStatus{}, err
+	}
+	return evaluateBudget(ctx, s, b, amounts, date)
+}
+
+func evaluateBudget(ctx context.Context, s Store, b Budget, amounts []BudgetAmount, date time.Time) (BudgetStatus, error) {
+	st := BudgetStatus{Budget: b, Limit: b.Amount}
+	st.Window, st.Active = BudgetWindow(b, date)
+	if !st.Active {
+		return st, nil
+	}
+	st.Limit = amountOn(amounts, b.Amount, st.Window.End)
+	stats, err := s.GetCategoryStats(ctx, st.Window, Filter{})
+	if err != nil {
+		return BudgetStatus{}, err
+	}
+	st.Spent = stats[b.Category]
+	return st, nil
+}
+
+// BudgetHistory evaluates every period of b that overlaps r, each against
+// the limit in force at the time. An open end of r means today.
+func BudgetHistory(ctx context.Context, s Store, b Budget, r DateRange) ([]BudgetStatus, error) {
+	amounts, err := s.GetBudgetAmounts(ctx, b.Category)
+	if err != nil {
+		return nil, err
+	}
+	if r.End == "" {
+		r.End = truncateDay(time.Now()).Format(dateLayout)
+	}
+	start := r.Start
+	if b.StartDate > start {
+		start = b.StartDate
+	}
+	if start == "" {
+		start = r.End
+	}
+
+	var history []BudgetStatus
+	date, err := time.Parse(dateLayout, start)
+	if err != nil {
+		return nil, invalidf("invalid date format, use YYYY-MM-DD")
+	}
+	for date.Format(dateLayout) <= r.End {
+		st, err := evaluateBudget(ctx, s, b, amounts, date)
+		if err != nil {
+			return nil, err
+		}
+		if !st.Active {
+			break
+		}
+		history = append(history, st)
+		end, _ := time.Parse(dateLayout, st.Window.End)
+		date = end.AddDate(0, 0, 1)
+	}
+	return history, nil
+}
@@ -0,0 +1,1877 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The conformance suite below runs against every Store implementation so
+// they cannot drift apart.
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		s, err := Open(t.Context(), filepath.Join(t.TempDir(), "finance.db"), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		return NewMemoryStore()
+	})
+}
+
+func TestSQLiteConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "finance.db")
+	const writers, perWriter = 4, 25
+
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		go func() {
+			s, err := Open(t.Context(), path, Options{})
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer s.Close()
+			for i := 0; i < perWriter; i++ {
+				tr := Transaction{Type: "expense", Category: "food", Amount: 1, Date: "2024-01-01"}
+				if _, err = s.AddTransaction(t.Context(), tr); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for w := 0; w < writers; w++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := Open(t.Context(), path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	totals, err := s.GetTransactionTotals(t.Context(), TransactionFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Count != writers*perWriter {
+		t.Errorf("count = %d, want %d", totals.Count, writers*perWriter)
+	}
+}
+
+func TestSQLiteResetUndo(t *testing.T) {
+	ctx := t.Context()
+	s, err := Open(ctx, filepath.Join(t.TempDir(), "finance.db"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	addSamples(t, s)
+	if _, err = s.AddRule(ctx, Rule{Pattern: "bus", Category: "transport"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.AddNotifier(ctx, NotifierConfig{Kind: NotifierDesktop}); err != nil {
+		t.Fatal(err)
+	}
+	alert := Alert{Category: "food", Window: DateRange{"2024-01-01", "2024-01-31"}, Threshold: 90, Spent: 95, Limit: 100}
+	if _, err = s.RecordAlert(ctx, alert); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func() (rules, notifiers, alerts int) {
+		t.Helper()
+		r, err := s.GetRules(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := s.GetNotifiers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := s.GetAlerts(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(r), len(n), len(a)
+	}
+
+	if err = s.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r, n, a := count(); r != 0 || n != 0 || a != 0 {
+		t.Errorf("after Reset: %d rules, %d notifiers, %d alerts, want none", r, n, a)
+	}
+	// Alerts are not journaled, so one written after the reset must
+	// survive undoing it rather than be overwritten by an older alert
+	// with the same id.
+	other := Alert{Category: "rent", Window: alert.Window, Threshold: 100, Spent: 120, Limit: 100}
+	if _, err = s.RecordAlert(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := s.RecordAlert(ctx, alert); err != nil || !claimed {
+		t.Errorf("RecordAlert after Reset = %v, %v, want the threshold claimable again", claimed, err)
+	}
+
+	if _, err = s.Undo(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if r, n, a := count(); r != 1 || n != 1 || a != 2 {
+		t.Errorf("after undoing Reset: %d rules, %d notifiers, %d alerts, want 1, 1 and 2", r, n, a)
+	}
+}
+
+func TestSQLiteUndoRedo(t *testing.T) {
+	ctx := t.Context()
+	s, err := Open(ctx, filepath.Join(t.TempDir(), "finance.db"), Options{Command: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ids := addSamples(t, s)
+
+	// state is everything the operations below touch, without versions,
+	// which undo and redo move forward instead of back.
+	type state struct {
+		Transactions []Transaction
+		Budgets      []Budget
+	}
+	snapshot := func() state {
+		t.Helper()
+		transactions, err := s.GetTransactions(ctx, TransactionFilter{SortBy: "id", Ascending: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		budgets, err := s.GetBudgets(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range transactions {
+			transactions[i].Version = 0
+		}
+		for i := range budgets {
+			budgets[i].Version = 0
+		}
+		return state{transactions, budgets}
+	}
+
+	operations := []struct {
+		name string
+		run  func() error
+	}{
+		{"update", func() error {
+			return s.UpdateTransaction(ctx, ids[0], Transaction{Category: "coffee", Amount: -1})
+		}},
+		{"delete", func() error { return s.DeleteTransaction(ctx, ids[1]) }},
+		{"bulk update", func() error {
+			_, err := s.BulkUpdateTransactions(ctx, anyVersion(ids[2], ids[3]), Transaction{Category: "misc", Amount: -1})
+			return err
+		}},
+		{"add budget", func() error { return s.AddBudget(ctx, Budget{Category: "food", Amount: 300, Period: "monthly"}) }},
+		{"update budget", func() error { return s.UpdateBudget(ctx, "food", 250, "2024-01-01") }},
+	}
+	states := []state{snapshot()}
+	for _, op := range operations {
+		if err = op.run(); err != nil {
+			t.Fatalf("%s: %v", op.name, err)
+		}
+		states = append(states, snapshot())
+	}
+
+	for i := len(operations) - 1; i >= 0; i-- {
+		if _, err = s.Undo(ctx, 1); err != nil {
+			t.Fatalf("undo %s: %v", operations[i].name, err)
+		}
+		if got := snapshot(); !reflect.DeepEqual(got, states[i]) {
+			t.Errorf("after undoing %s: %+v, want %+v", operations[i].name, got, states[i])
+		}
+	}
+
+	history, err := s.GetJournal(ctx, len(operations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range history {
+		if !e.Undone || e.Command != "test" {
+			t.Errorf("history entry after undoing = %+v, want undone by test", e)
+		}
+	}
+
+	entries, err := s.Redo(ctx, len(operations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(operations) {
+		t.Fatalf("redid %d operations, want %d", len(entries), len(operations))
+	}
+	if bulk := entries[2]; bulk.Updated != 2 || bulk.Added != 0 || bulk.Deleted != 0 {
+		t.Errorf("redone bulk update = %+v, want 2 rows updated", bulk)
+	}
+	if got, want := snapshot(), states[len(states)-1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("after redoing everything: %+v, want %+v", got, want)
+	}
+
+	// A new change after an undo throws away what could be redone.
+	if _, err = s.Undo(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.UpdateTransaction(ctx, ids[4], Transaction{Description: "new", Amount: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err = s.Redo(ctx, 1); err != nil || len(entries) != 0 {
+		t.Errorf("Redo after a new change = %+v, %v, want nothing to redo", entries, err)
+	}
+	if _, err = s.GetBudget(ctx, "food"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("discarded budget came back: error = %v, want ErrNotFound", err)
+	}
+	if history, err = s.GetJournal(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != len(sampleTransactions)+len(operations)-2+1 || history[0].Undone || history[0].Updated != 1 {
+		t.Errorf("history after a new change = %+v", history)
+	}
+}
+
+func TestSQLiteEmptyTrash(t *testing.T) {
+	ctx := t.Context()
+	s, err := Open(ctx, filepath.Join(t.TempDir(), "finance.db"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ids := addSamples(t, s)
+
+	for _, id := range ids[:2] {
+		if err = s.DeleteTransaction(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().AddDate(0, 0, -40).Format("2006-01-02 15:04:05")
+	if _, err = s.db.ExecContext(ctx, "UPDATE transactions SET deleted_at = ? WHERE id = ?", old, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := s.EmptyTrash(ctx, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d, want only the transaction trashed 40 days ago", removed)
+	}
+	if _, err = s.GetTransaction(ctx, ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("old trashed transaction: error = %v, want ErrNotFound", err)
+	}
+	if got, err := s.GetTransaction(ctx, ids[1]); err != nil || got.DeletedAt == "" {
+		t.Errorf("recently trashed transaction = %+v, %v, want it still in the trash", got, err)
+	}
+
+	if removed, err = s.EmptyTrash(ctx, 0); err != nil || removed != 1 {
+		t.Errorf("EmptyTrash(0) = %d, %v, want the rest removed", removed, err)
+	}
+	if trashed := listIDs(t, s, TransactionFilter{Trashed: true}); len(trashed) != 0 {
+		t.Errorf("trash after emptying = %v, want empty", trashed)
+	}
+	if live := listIDs(t, s, TransactionFilter{}); len(live) != len(ids)-2 {
+		t.Errorf("emptying the trash left %d live transactions, want %d", len(live), len(ids)-2)
+	}
+}
+
+func TestSQLiteAuditLog(t *testing.T) {
+	ctx := t.Context()
+	s, err := Open(ctx, filepath.Join(t.TempDir(), "finance.db"), Options{User: "alice", Command: "add"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	id, err := s.AddTransaction(ctx, Transaction{Type: "expense", Category: "food", Amount: 10, Date: "2024-01-05"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.opts.User, s.opts.Command = "bob", "update"
+	if err = s.UpdateTransaction(ctx, id, Transaction{Category: "coffee", Amount: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddBudget(ctx, Budget{Category: "food", Amount: 300, Period: "monthly"}); err != nil {
+		t.Fatal(err)
+	}
+
+	audit := func(f AuditFilter) []AuditEntry {
+		t.Helper()
+		entries, err := s.GetAuditLog(ctx, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+	all := len(audit(AuditFilter{}))
+
+	entries := audit(AuditFilter{Entity: "transactions", EntityID: id})
+	if len(entries) != 2 {
+		t.Fatalf("entries for transaction #%d = %+v, want 2", id, entries)
+	}
+	if e := entries[0]; e.Action != "update" || e.User != "bob" || e.Command != "update" ||
+		e.Changes["Category"] != (FieldChange{From: "food", To: "coffee"}) || len(e.Changes) != 1 {
+		t.Errorf("update entry = %+v", e)
+	}
+	if e := entries[1]; e.Action != "create" || e.User != "alice" {
+		t.Errorf("create entry = %+v", e)
+	}
+	if got := audit(AuditFilter{User: "alice"}); len(got) != 1 || got[0].EntityID != id {
+		t.Errorf("entries by alice = %+v, want the creation", got)
+	}
+	if got := audit(AuditFilter{Entity: "budgets"}); len(got) != 1 || got[0].User != "bob" {
+		t.Errorf("budget entries = %+v, want one by bob", got)
+	}
+	today := time.Now().Format(dateLayout)
+	yesterday := time.Now().AddDate(0, 0, -1).Format(dateLayout)
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(dateLayout)
+	if got := audit(AuditFilter{StartDate: today, EndDate: today}); len(got) != all {
+		t.Errorf("entries for today = %d, want all %d", len(got), all)
+	}
+	if got := audit(AuditFilter{EndDate: yesterday}); len(got) != 0 {
+		t.Errorf("entries up to yesterday = %+v, want none", got)
+	}
+	if got := audit(AuditFilter{StartDate: tomorrow}); len(got) != 0 {
+		t.Errorf("entries from tomorrow = %+v, want none", got)
+	}
+
+	// Entries are written in the mutation's transaction, so a mutation
+	// that fails leaves none behind.
+	err = s.withJournal(ctx, func(j *journal) error {
+		before := Transaction{ID: id, Category: "coffee"}
+		after := Transaction{ID: id, Category: "tea"}
+		if err := j.transaction(id, &before, &after); err != nil {
+			return err
+		}
+		return conflictf("failed after writing the audit entry")
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("failing mutation error = %v, want ErrConflict", err)
+	}
+	if err = s.UpdateTransaction(ctx, id, Transaction{Category: "tea", Amount: -1, Version: 1}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale update error = %v, want ErrConflict", err)
+	}
+	if got := len(audit(AuditFilter{})); got != all {
+		t.Errorf("failed mutations left %d audit entries, want %d", got, all)
+	}
+
+	for _, query := range []string{"UPDATE audit_log SET user = 'mallory'", "DELETE FROM audit_log"} {
+		if _, err = s.db.ExecContext(ctx, query); err == nil || !strings.Contains(err.Error(), "append-only") {
+			t.Errorf("%s: error = %v, want the append-only trigger to abort it", query, err)
+		}
+	}
+	if got := audit(AuditFilter{User: "mallory"}); len(got) != 0 {
+		t.Errorf("entries by mallory = %+v, want none", got)
+	}
+	if got := len(audit(AuditFilter{})); got != all {
+		t.Errorf("audit log has %d entries after the rejected changes, want %d", got, all)
+	}
+}
+
+func TestSQLiteRestoreWithOtherConnection(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "finance.db")
+	s, err := Open(ctx, path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	addSamples(t, s)
+	backup := filepath.Join(t.TempDir(), "backup.db")
+	if err = s.Backup(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process keeps the database open and writes to it, leaving
+	// frames in the WAL.
+	other, err := Open(ctx, path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	for range 3 {
+		if _, err = other.AddTransaction(ctx, Transaction{Type: "expense", Category: "food", Amount: 1, Date: "2024-03-01"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = s.Restore(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(ctx, path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	count := func(want int, when string) {
+		t.Helper()
+		for _, store := range []Store{s, other, reopened} {
+			totals, err := store.GetTransactionTotals(ctx, TransactionFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if totals.Count != want {
+				t.Errorf("%s: %d transactions, want %d", when, totals.Count, want)
+			}
+		}
+	}
+	count(len(sampleTransactions), "after Restore")
+
+	// The other process, still holding the database open, writes to the
+	// restored database and everyone sees it.
+	added, err := other.AddTransaction(ctx, Transaction{Type: "income", Category: "gift", Amount: 5, Date: "2024-03-02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count(len(sampleTransactions)+1, "after writing to the restored database")
+	if added <= len(sampleTransactions)+3 {
+		t.Errorf("transaction added after Restore got id %d, which was already used", added)
+	}
+
+	// The audit log still has the entries written after the backup.
+	audit, err := s.GetAuditLog(ctx, AuditFilter{Entity: "transactions"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audit) != len(sampleTransactions)+4 {
+		t.Errorf("audit log has %d transaction entries after Restore, want %d", len(audit), len(sampleTransactions)+4)
+	}
+	if restores, err := s.GetAuditLog(ctx, AuditFilter{Entity: "database"}); err != nil || len(restores) != 1 || restores[0].Action != "restore" {
+		t.Errorf("database entries = %+v, %v, want the restore", restores, err)
+	}
+
+	if _, err = s.Restore(ctx, "missing.db"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore of a missing backup error = %v, want ErrNotFound", err)
+	}
+	if _, err = s.AddTransaction(ctx, sampleTransactions[0]); err != nil {
+		t.Errorf("store unusable after a failed Restore: %v", err)
+	}
+}
+
+func TestEncryptWithOtherConnection(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "finance.db")
+	opts := Options{Passphrase: func(string) (string, error) { return "secret", nil }}
+	s, err := Open(ctx, path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	addSamples(t, s)
+
+	// An idle connection from another process would go on writing to the
+	// plain file after it was replaced.
+	other, err := Open(ctx, path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.GetTransactions(ctx, TransactionFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Encrypt(ctx, "secret"); !errors.Is(err, ErrConflict) {
+		t.Errorf("Encrypt with the database open elsewhere: error = %v, want ErrConflict", err)
+	}
+	if s.Encrypted() {
+		t.Error("database was encrypted while open elsewhere")
+	}
+	if _, err = s.AddTransaction(ctx, sampleTransactions[0]); err != nil {
+		t.Fatalf("store unusable after a refused Encrypt: %v", err)
+	}
+	other.Close()
+
+	if err = s.Encrypt(ctx, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err = os.Stat(path + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left next to the encrypted file: %v", suffix, err)
+		}
+	}
+	reopened, err := Open(ctx, path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got := listIDs(t, reopened, TransactionFilter{}); len(got) != len(sampleTransactions)+1 {
+		t.Errorf("encrypted database has %d transactions, want %d", len(got), len(sampleTransactions)+1)
+	}
+}
+
+func TestEncryptedConcurrentSave(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "finance.db")
+	opts := Options{Passphrase: func(string) (string, error) { return "secret", nil }}
+
+	first, err := Open(ctx, path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if err = first.Encrypt(ctx, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := Open(ctx, path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	tr := Transaction{Type: "expense", Category: "food", Amount: 1, Date: "2024-01-01"}
+	if _, err = second.AddTransaction(ctx, tr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = first.AddTransaction(ctx, tr); !errors.Is(err, ErrConflict) {
+		t.Errorf("save over a newer file: error = %v, want ErrConflict", err)
+	}
+}
+
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Store)
+	}{
+		{"AddAndGet", testAddAndGet},
+		{"ListFilters", testListFilters},
+		{"ListWhere", testListWhere},
+		{"ListSortAndPage", testListSortAndPage},
+		{"Totals", testTotals},
+		{"Update", testUpdate},
+		{"Trash", testTrash},
+		{"Bulk", testBulk},
+		{"Budgets", testBudgets},
+		{"Stats", testStats},
+		{"CheckBudget", testCheckBudget},
+		{"Envelopes", testEnvelopes},
+		{"BudgetHistory", testBudgetHistory},
+		{"Goals", testGoals},
+		{"Plan", testPlan},
+		{"Alerts", testAlerts},
+		{"Trends", testTrends},
+		{"Calendar", testCalendar},
+		{"Forecast", testForecast},
+		{"Anomalies", testAnomalies},
+		{"Duplicates", testDuplicates},
+		{"Rules", testRules},
+		{"Versions", testVersions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+var sampleTransactions = []Transaction{
+	{Type: "income", Category: "salary", Amount: 2500, Date: "2024-01-01"},
+	{Type: "expense", Category: "food", Amount: 12.5, Description: "Coffee beans", Date: "2024-01-03"},
+	{Type: "expense", Category: "food", Amount: 40, Description: "groceries", Date: "2024-01-10"},
+	{Type: "expense", Category: "transport", Amount: 2.25, Description: "bus", Date: "2024-01-10"},
+	{Type: "expense", Category: "shopping", Amount: 150, Description: "shoes 50% off", Date: "2024-02-02"},
+	{Type: "income", Category: "freelance", Amount: 300, Date: "2024-02-15"},
+}
+
+// anyVersion is what a bulk operation takes to change ids at whatever
+// version they are.
+func anyVersion(ids ...int) map[int]int {
+	versions := make(map[int]int, len(ids))
+	for _, id := range ids {
+		versions[id] = 0
+	}
+	return versions
+}
+
+func addSamples(t *testing.T, s Store) []int {
+	t.Helper()
+	ctx := t.Context()
+	var ids []int
+	for _, tr := range sampleTransactions {
+		id, err := s.AddTransaction(ctx, tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func transactionIDs(transactions []Transaction) []int {
+	ids := []int{}
+	for _, tr := range transactions {
+		ids = append(ids, tr.ID)
+	}
+	return ids
+}
+
+func listIDs(t *testing.T, s Store, f TransactionFilter) []int {
+	t.Helper()
+	ctx := t.Context()
+	transactions, err := s.GetTransactions(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transactionIDs(transactions)
+}
+
+func mustFilter(t *testing.T, expr string) Filter {
+	t.Helper()
+	f, err := ParseFilter(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func testAddAndGet(t *testing.T, s Store) {
+	ctx := t.Context()
+	ids := addSamples(t, s)
+	if !reflect.DeepEqual(ids, []int{1, 2, 3, 4, 5, 6}) {
+		t.Fatalf("ids = %v, want 1..6", ids)
+	}
+
+	got, err := s.GetTransaction(ctx, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sampleTransactions[1]
+	want.ID, want.Version = ids[1], 1
+	if got != want {
+		t.Errorf("GetTransaction = %+v, want %+v", got, want)
+	}
+
+	if _, err = s.GetTransaction(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetTransaction(999) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testListFilters(t *testing.T, s Store) {
+	addSamples(t, s)
+
+	tests := []struct {
+		name   string
+		filter TransactionFilter
+		want   []int
+	}{
+		{"all", TransactionFilter{SortBy: "id", Ascending: true}, []int{1, 2, 3, 4, 5, 6}},
+		{"type", TransactionFilter{Type: "income", SortBy: "id", Ascending: true}, []int{1, 6}},
+		{"category", TransactionFilter{Category: "food", SortBy: "id", Ascending: true}, []int{2, 3}},
+		{"dates", TransactionFilter{StartDate: "2024-01-03", EndDate: "2024-01-10", SortBy: "id", Ascending: true}, []int{2, 3, 4}},
+		{"min", TransactionFilter{MinAmount: 40, SortBy: "id", Ascending: true}, []int{1, 3, 5, 6}},
+		{"max", TransactionFilter{MaxAmount: 40, SortBy: "id", Ascending: true}, []int{2, 3, 4}},
+		{"combined", TransactionFilter{Type: "expense", MinAmount: 10, MaxAmount: 100, SortBy: "id", Ascending: true}, []int{2, 3}},
+	}
+	for _, tt := range tests {
+		if got := listIDs(t, s, tt.filter); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testListWhere(t *testing.T, s Store) {
+	addSamples(t, s)
+
+	tests := []struct {
+		expr string
+		want []int
+	}{
+		{"amount > 100", []int{1, 5, 6}},
+		{"amount >= 40 and type = expense", []int{3, 5}},
+		{"category in (food, transport)", []int{2, 3, 4}},
+		{"category not in (food, transport)", []int{1, 5, 6}},
+		{"desc ~ coffee", []int{2}},
+		{"desc ~ COFFEE", []int{2}},
+		{`desc ~ "50%"`, []int{5}},
+		{"desc !~ o", []int{1, 4, 6}},
+		{"not (type = income or amount < 10)", []int{2, 3, 5}},
+		{"date < 2024-01-10", []int{1, 2}},
+		{"id != 1 and date <= 2024-01-10", []int{2, 3, 4}},
+		{"desc = ''", []int{1, 6}},
+	}
+	for _, tt := range tests {
+		got := listIDs(t, s, TransactionFilter{Where: mustFilter(t, tt.expr), SortBy: "id", Ascending: true})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func testListSortAndPage(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+
+	tests := []struct {
+		name   string
+		filter TransactionFilter
+		want   []int
+	}{
+		{"default", TransactionFilter{}, []int{6, 5, 4, 3, 2, 1}},
+		{"date asc", TransactionFilter{SortBy: "date", Ascending: true}, []int{1, 2, 3, 4, 5, 6}},
+		{"amount", TransactionFilter{SortBy: "amount"}, []int{1, 6, 5, 3, 2, 4}},
+		{"category asc", TransactionFilter{SortBy: "category", Ascending: true}, []int{2, 3, 6, 1, 5, 4}},
+		{"limit", TransactionFilter{SortBy: "id", Limit: 2}, []int{6, 5}},
+		{"offset", TransactionFilter{SortBy: "id", Offset: 4}, []int{2, 1}},
+		{"page", TransactionFilter{SortBy: "id", Ascending: true, Limit: 2, Offset: 2}, []int{3, 4}},
+		{"past end", TransactionFilter{Offset: 10}, []int{}},
+	}
+	for _, tt := range tests {
+		if got := listIDs(t, s, tt.filter); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := s.GetTransactions(ctx, TransactionFilter{SortBy: "nope"}); err == nil {
+		t.Error("invalid sort field was accepted")
+	}
+}
+
+func testTotals(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+
+	totals, err := s.GetTransactionTotals(ctx, TransactionFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := TransactionTotals{Count: 6, Income: 2800, Expense: 204.75}
+	if totals != want {
+		t.Errorf("totals = %+v, want %+v", totals, want)
+	}
+
+	// Totals ignore paging.
+	totals, err = s.GetTransactionTotals(ctx, TransactionFilter{Category: "food", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = TransactionTotals{Count: 2, Expense: 52.5}
+	if totals != want {
+		t.Errorf("food totals = %+v, want %+v", totals, want)
+	}
+}
+
+func testUpdate(t *testing.T, s Store) {
+	ctx := t.Context()
+	ids := addSamples(t, s)
+
+	if err := s.UpdateTransaction(ctx, ids[1], Transaction{Category: "coffee", Amount: -1}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetTransaction(ctx, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sampleTransactions[1]
+	want.ID, want.Category, want.Version = ids[1], "coffee", 2
+	if got != want {
+		t.Errorf("after update = %+v, want %+v", got, want)
+	}
+
+	if err = s.UpdateTransaction(ctx, ids[1], Transaction{Amount: -1}); !errors.Is(err, ErrValidation) {
+		t.Errorf("empty update error = %v, want ErrValidation", err)
+	}
+	invalid := []Transaction{
+		{Type: "transfer", Amount: -1},
+		{Date: "banana", Amount: -1},
+		{Amount: 0},
+		{Category: "coffee", Amount: -5},
+	}
+	for _, update := range invalid {
+		if err = s.UpdateTransaction(ctx, ids[1], update); !errors.Is(err, ErrValidation) {
+			t.Errorf("update %+v error = %v, want ErrValidation", update, err)
+		}
+	}
+	if got, _ = s.GetTransaction(ctx, ids[1]); got != want {
+		t.Errorf("rejected updates changed the transaction: %+v", got)
+	}
+	if err = s.UpdateTransaction(ctx, ids[1], Transaction{Description: "flat white", Tags: "morning, coffee,morning"}); err != nil {
+		t.Errorf("update without an amount: %v", err)
+	}
+	want.Description, want.Tags, want.Version = "flat white", "morning,coffee", 3
+	if got, _ = s.GetTransaction(ctx, ids[1]); got != want {
+		t.Errorf("after an update without an amount = %+v, want %+v", got, want)
+	}
+	if err = s.UpdateTransaction(ctx, 999, Transaction{Category: "x", Amount: -1}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("updating a missing transaction: error = %v, want ErrNotFound", err)
+	}
+
+	if err = s.DeleteTransaction(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.UpdateTransaction(ctx, ids[2], Transaction{Category: "x", Amount: -1}); !errors.Is(err, ErrConflict) {
+		t.Errorf("updating a trashed transaction: error = %v, want ErrConflict", err)
+	}
+	if got, _ = s.GetTransaction(ctx, ids[2]); got.Category != "food" {
+		t.Errorf("trashed transaction was updated: %+v", got)
+	}
+
+	for _, update := range []Transaction{{Type: "transfer", Amount: -1}, {Category: "coffee", Amount: -5}} {
+		if _, err = s.BulkUpdateTransactions(ctx, anyVersion(ids...), update); !errors.Is(err, ErrValidation) {
+			t.Errorf("bulk update %+v error = %v, want ErrValidation", update, err)
+		}
+	}
+}
+
+func testTrash(t *testing.T, s Store) {
+	ctx := t.Context()
+	ids := addSamples(t, s)
+
+	if err := s.DeleteTransaction(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteTransaction(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting a missing transaction: error = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteTransaction(ctx, ids[1]); !errors.Is(err, ErrConflict) {
+		t.Errorf("deleting a trashed transaction: error = %v, want ErrConflict", err)
+	}
+
+	if got := listIDs(t, s, TransactionFilter{Category: "food"}); !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("live food = %v, want [3]", got)
+	}
+	if got := listIDs(t, s, TransactionFilter{Trashed: true}); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("trash = %v, want [2]", got)
+	}
+	got, err := s.GetTransaction(ctx, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DeletedAt == "" {
+		t.Error("trashed transaction has no DeletedAt")
+	}
+	if totals, _ := s.GetTransactionTotals(ctx, TransactionFilter{}); totals.Count != 5 {
+		t.Errorf("count = %d, want 5", totals.Count)
+	}
+	if stats, _ := s.GetCategoryStats(ctx, DateRange{}, Filter{}); stats["food"] != 40 {
+		t.Errorf("food stats = %v, want 40", stats["food"])
+	}
+
+	if err = s.RestoreTransaction(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = s.GetTransaction(ctx, ids[1]); got.DeletedAt != "" {
+		t.Errorf("restored transaction still trashed: %+v", got)
+	}
+	if err = s.RestoreTransaction(ctx, ids[1]); !errors.Is(err, ErrConflict) {
+		t.Errorf("restoring a live transaction: error = %v, want ErrConflict", err)
+	}
+	if err = s.RestoreTransaction(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("restoring a missing transaction: error = %v, want ErrNotFound", err)
+	}
+}
+
+func testBulk(t *testing.T, s Store) {
+	ctx := t.Context()
+	ids := addSamples(t, s)
+
+	if err := s.DeleteTransaction(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.BulkUpdateTransactions(ctx, anyVersion(ids[0], ids[1], ids[2], 999), Transaction{Category: "misc", Amount: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("updated %d, want 2", n)
+	}
+	if got := listIDs(t, s, TransactionFilter{Category: "misc", SortBy: "id", Ascending: true}); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("misc = %v, want [2 3]", got)
+	}
+	if _, err = s.BulkUpdateTransactions(ctx, anyVersion(ids...), Transaction{Amount: -1}); err == nil {
+		t.Error("empty bulk update was accepted")
+	}
+
+	n, err = s.BulkDeleteTransactions(ctx, anyVersion(ids[0], ids[1], ids[3]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("deleted %d, want 2", n)
+	}
+	if got := listIDs(t, s, TransactionFilter{SortBy: "id", Ascending: true}); !reflect.DeepEqual(got, []int{3, 5, 6}) {
+		t.Errorf("live = %v, want [3 5 6]", got)
+	}
+}
+
+func testBudgets(t *testing.T, s Store) {
+	ctx := t.Context()
+	food := Budget{Category: "food", Amount: 300, Period: "monthly"}
+	fun := Budget{Category: "fun", Amount: 50, Period: "weekly", StartDate: "2024-01-01", EndDate: "2024-12-31", Thresholds: []float64{50, 100}}
+	for _, b := range []Budget{food, fun} {
+		if err := s.AddBudget(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddBudget(ctx, food); !errors.Is(err, ErrConflict) {
+		t.Errorf("duplicate budget error = %v, want ErrConflict", err)
+	}
+
+	got, err := s.GetBudget(ctx, "fun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fun.ID, fun.Version = got.ID, 1
+	if !reflect.DeepEqual(got, fun) {
+		t.Errorf("GetBudget = %+v, want %+v", got, fun)
+	}
+	if _, err = s.GetBudget(ctx, "rent"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetBudget(rent) error = %v, want ErrNotFound", err)
+	}
+
+	budgets, err := s.GetBudgets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(budgets) != 2 || budgets[0].Category != "food" || budgets[1].Category != "fun" {
+		t.Errorf("GetBudgets = %+v", budgets)
+	}
+
+	if err = s.RemoveBudget(ctx, "food"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RemoveBudget(ctx, "food"); err != nil {
+		t.Errorf("removing a missing budget: %v", err)
+	}
+	if budgets, _ = s.GetBudgets(ctx); len(budgets) != 1 {
+		t.Errorf("%d budgets left, want 1", len(budgets))
+	}
+	if err = s.AddBudget(ctx, food); err != nil {
+		t.Errorf("re-adding a removed budget: %v", err)
+	}
+}
+
+func testStats(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+
+	tests := []struct {
+		name            string
+		r               DateRange
+		where           string
+		income, expense float64
+		stats           map[string]float64
+	}{
+		{"all", DateRange{}, "", 2800, 204.75,
+			map[string]float64{"food": 52.5, "transport": 2.25, "shopping": 150}},
+		{"january", DateRange{"2024-01-01", "2024-01-31"}, "", 2500, 54.75,
+			map[string]float64{"food": 52.5, "transport": 2.25}},
+		{"open start", DateRange{End: "2024-01-03"}, "", 2500, 12.5,
+			map[string]float64{"food": 12.5}},
+		{"where", DateRange{}, "amount < 100", 0, 54.75,
+			map[string]float64{"food": 52.5, "transport": 2.25}},
+		{"empty", DateRange{"2023-01-01", "2023-12-31"}, "", 0, 0,
+			map[string]float64{}},
+	}
+	for _, tt := range tests {
+		where := mustFilter(t, tt.where)
+		income, expense, err := s.GetBalance(ctx, tt.r, where)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if income != tt.income || expense != tt.expense {
+			t.Errorf("%s: balance = %v/%v, want %v/%v", tt.name, income, expense, tt.income, tt.expense)
+		}
+		stats, err := s.GetCategoryStats(ctx, tt.r, where)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(stats, tt.stats) {
+			t.Errorf("%s: stats = %v, want %v", tt.name, stats, tt.stats)
+		}
+	}
+}
+
+func testVersions(t *testing.T, s Store) {
+	ctx := t.Context()
+	ids := addSamples(t, s)
+
+	version := func(id int) int {
+		t.Helper()
+		tr, err := s.GetTransaction(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr.Version
+	}
+
+	if err := s.UpdateTransaction(ctx, ids[1], Transaction{Category: "coffee", Amount: -1, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(ids[1]); v != 2 {
+		t.Errorf("version after update = %d, want 2", v)
+	}
+	err := s.UpdateTransaction(ctx, ids[1], Transaction{Category: "tea", Amount: -1, Version: 1})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("stale update error = %v, want ErrConflict", err)
+	}
+	if got, _ := s.GetTransaction(ctx, ids[1]); got.Category != "coffee" {
+		t.Errorf("stale update was applied: %+v", got)
+	}
+	if err = s.UpdateTransaction(ctx, ids[1], Transaction{Category: "tea", Amount: -1}); err != nil {
+		t.Errorf("unversioned update: %v", err)
+	}
+
+	if _, err = s.BulkUpdateTransactions(ctx, anyVersion(ids[2:4]...), Transaction{Category: "misc", Amount: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(ids[2]); v != 2 {
+		t.Errorf("version after bulk update = %d, want 2", v)
+	}
+	_, err = s.BulkUpdateTransactions(ctx, map[int]int{ids[2]: 2, ids[3]: 1}, Transaction{Category: "rent", Amount: -1})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("stale bulk update error = %v, want ErrConflict", err)
+	}
+	_, err = s.BulkDeleteTransactions(ctx, map[int]int{ids[2]: 2, 999: 1})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("bulk delete of a missing transaction error = %v, want ErrConflict", err)
+	}
+	if got, _ := s.GetTransaction(ctx, ids[2]); got.Category != "misc" || got.DeletedAt != "" {
+		t.Errorf("failed bulk operations changed #%d: %+v", ids[2], got)
+	}
+	if n, err := s.BulkDeleteTransactions(ctx, map[int]int{ids[2]: 2, ids[3]: 2}); err != nil || n != 2 {
+		t.Errorf("bulk delete at the current versions = %d, %v, want 2", n, err)
+	}
+
+	if err = s.DeleteTransaction(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RestoreTransaction(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(ids[0]); v != 3 {
+		t.Errorf("version after trash and restore = %d, want 3", v)
+	}
+}
+
+func testCheckBudget(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+	food := Budget{Category: "food", Amount: 100, Period: "monthly", StartDate: "2024-01-05"}
+	if err := s.AddBudget(ctx, food); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		date   string
+		active bool
+		window DateRange
+		spent  float64
+	}{
+		{"2024-01-20", true, DateRange{"2024-01-05", "2024-01-31"}, 40},
+		{"2024-02-29", true, DateRange{"2024-02-01", "2024-02-29"}, 0},
+		{"2024-01-04", false, DateRange{}, 0},
+	}
+	for _, tt := range tests {
+		date, _ := time.Parse(dateLayout, tt.date)
+		st, err := CheckBudget(ctx, s, "food", date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Active != tt.active || st.Window != tt.window || st.Spent != tt.spent || st.Budget.Amount != 100 {
+			t.Errorf("%s: CheckBudget = %+v, want active %v, window %v, spent %v", tt.date, st, tt.active, tt.window, tt.spent)
+		}
+	}
+
+	if _, err := CheckBudget(ctx, s, "rent", time.Now()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CheckBudget without budget error = %v, want ErrNotFound", err)
+	}
+}
+
+func testEnvelopes(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+	transport := Budget{Category: "transport", Amount: 10, Period: "monthly"}
+	if err := s.AddBudget(ctx, transport); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddBudget(ctx, Budget{Category: "food", Amount: 10, Period: "monthly", Rollover: RolloverSurplus}); !errors.Is(err, ErrValidation) {
+		t.Errorf("rollover without start date error = %v, want ErrValidation", err)
+	}
+	if _, err := s.MoveMoney(ctx, BudgetMove{Date: "2024-02-10", From: "transport", To: "food", Amount: 5}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("move to category without budget error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.MoveMoney(ctx, BudgetMove{Date: "2024-02-10", From: "transport", To: "transport", Amount: 5}); !errors.Is(err, ErrValidation) {
+		t.Errorf("move to same category error = %v, want ErrValidation", err)
+	}
+
+	// Food spends 52.5 in January and nothing in February, when 5 is moved
+	// in from transport.
+	tests := []struct {
+		amount   float64
+		rollover string
+		cap      float64
+		carried  float64
+	}{
+		{100, RolloverNone, 0, 0},
+		{100, RolloverSurplus, 0, 47.5},
+		{100, RolloverBoth, 0, 47.5},
+		{100, RolloverCapped, 20, 20},
+		{30, RolloverSurplus, 0, 0},
+		{30, RolloverBoth, 0, -22.5},
+		{30, RolloverCapped, 20, 0},
+	}
+	for i, tt := range tests {
+		if err := s.RemoveBudget(ctx, "food"); err != nil {
+			t.Fatal(err)
+		}
+		food := Budget{Category: "food", Amount: tt.amount, Period: "monthly", StartDate: "2024-01-01", Rollover: tt.rollover, RolloverCap: tt.cap}
+		if err := s.AddBudget(ctx, food); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if _, err := s.MoveMoney(ctx, BudgetMove{Date: "2024-02-10", From: "transport", To: "food", Amount: 5, Note: "bus pass"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		envelopes, err := Envelopes(ctx, s, time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Envelope{
+			{Category: "transport", Window: DateRange{"2024-02-01", "2024-02-29"}, Assigned: 10, Moved: -5, Available: 5},
+			{Category: "food", Window: DateRange{"2024-02-01", "2024-02-29"}, Assigned: tt.amount, Carried: tt.carried, Moved: 5, Available: tt.amount + tt.carried + 5},
+		}
+		if !reflect.DeepEqual(envelopes, want) {
+			t.Errorf("%s rollover of %v: Envelopes = %+v, want %+v", tt.rollover, tt.amount, envelopes, want)
+		}
+	}
+
+	moves, err := s.GetBudgetMoves(ctx, DateRange{Start: "2024-02-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 1 || moves[0].From != "transport" || moves[0].To != "food" || moves[0].Note != "bus pass" {
+		t.Errorf("GetBudgetMoves = %+v, want the one move", moves)
+	}
+	if moves, _ = s.GetBudgetMoves(ctx, DateRange{End: "2024-01-31"}); len(moves) != 0 {
+		t.Errorf("GetBudgetMoves before the move = %+v, want none", moves)
+	}
+}
+
+func testBudgetHistory(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+	if err := s.AddBudget(ctx, Budget{Category: "food", Amount: 50, Period: "monthly", StartDate: "2024-01-01"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateBudget(ctx, "food", 30, "2024-02-01"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateBudget(ctx, "food", 25, "2024-02-01"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateBudget(ctx, "rent", 25, "2024-02-01"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateBudget without budget error = %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateBudget(ctx, "food", 0, "2024-02-01"); !errors.Is(err, ErrValidation) {
+		t.Errorf("UpdateBudget to zero error = %v, want ErrValidation", err)
+	}
+
+	b, err := s.GetBudget(ctx, "food")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Amount != 25 || b.Version != 3 {
+		t.Errorf("budget after updates = %+v, want amount 25 at version 3", b)
+	}
+	amounts, err := s.GetBudgetAmounts(ctx, "food")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(amounts) != 2 || amounts[0].EffectiveFrom != "" || amounts[0].Amount != 50 || amounts[1].EffectiveFrom != "2024-02-01" || amounts[1].Amount != 25 {
+		t.Errorf("GetBudgetAmounts = %+v, want 50 from the start and 25 from February", amounts)
+	}
+
+	// A limit dated in the future is recorded but not in force yet.
+	if err = s.UpdateBudget(ctx, "food", 99, time.Now().AddDate(0, 0, 7).Format(dateLayout)); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := s.GetBudget(ctx, "food"); current.Amount != 25 {
+		t.Errorf("budget after a future update = %+v, want amount 25 until it takes effect", current)
+	}
+	if budgets, _ := s.GetBudgets(ctx); len(budgets) != 1 || budgets[0].Amount != 25 {
+		t.Errorf("GetBudgets after a future update = %+v, want amount 25", budgets)
+	}
+
+	history, err := BudgetHistory(ctx, s, b, DateRange{"2024-01-15", "2024-02-10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []BudgetStatus
+	for _, st := range history {
+		got = append(got, BudgetStatus{Window: st.Window, Active: st.Active, Limit: st.Limit, Spent: st.Spent})
+	}
+	want := []BudgetStatus{
+		{Window: DateRange{"2024-01-01", "2024-01-31"}, Active: true, Limit: 50, Spent: 52.5},
+		{Window: DateRange{"2024-02-01", "2024-02-29"}, Active: true, Limit: 25, Spent: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BudgetHistory = %+v, want %+v", got, want)
+	}
+
+	if err := s.RemoveBudget(ctx, "food"); err != nil {
+		t.Fatal(err)
+	}
+	if amounts, _ = s.GetBudgetAmounts(ctx, "food"); len(amounts) != 0 {
+		t.Errorf("GetBudgetAmounts after removal = %+v, want none", amounts)
+	}
+}
+
+func testGoals(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+	goals := []Goal{
+		{Name: "raise", Kind: GoalIncome, Target: 5600, TargetDate: "2024-06-30", StartDate: "2024-01-01"},
+		{Name: "freelance", Kind: GoalIncome, Category: "freelance", Target: 200, TargetDate: "2024-06-30"},
+		{Name: "cushion", Kind: GoalSavings, Target: 5190.5, TargetDate: "2024-12-31"},
+	}
+	for _, g := range goals {
+		if err := s.AddGoal(ctx, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddGoal(ctx, goals[0]); !errors.Is(err, ErrConflict) {
+		t.Errorf("duplicate AddGoal error = %v, want ErrConflict", err)
+	}
+	if err := s.AddGoal(ctx, Goal{Name: "x", Kind: "spending", Target: 1, TargetDate: "2024-01-01"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("AddGoal with invalid kind error = %v, want ErrValidation", err)
+	}
+
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		saved     float64
+		remaining float64
+		projected bool
+	}{
+		{"raise", 2800, 2800, true},
+		{"freelance", 300, 0, false},
+		{"cushion", 2595.25, 2595.25, true},
+	}
+	for _, tt := range tests {
+		g, err := s.GetGoal(ctx, tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, err := GoalProgress(ctx, s, g, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Saved != tt.saved || st.Remaining != tt.remaining || (st.Projected != "") != tt.projected {
+			t.Errorf("%s: GoalProgress = %+v, want saved %v, remaining %v", tt.name, st, tt.saved, tt.remaining)
+		}
+		if tt.remaining > 0 && (st.MonthlyNeeded <= 0 || st.MonthlyRate <= 0 || st.Projected <= "2024-03-31") {
+			t.Errorf("%s: GoalProgress = %+v, want positive needed and recent rates and a later projection", tt.name, st)
+		}
+	}
+
+	if err := s.RemoveGoal(ctx, "raise"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveGoal(ctx, "raise"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RemoveGoal twice error = %v, want ErrNotFound", err)
+	}
+	if list, _ := s.GetGoals(ctx); len(list) != 2 {
+		t.Errorf("GetGoals after removal = %+v, want 2 goals", list)
+	}
+}
+
+func testPlan(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+
+	p, err := MonthPlan(ctx, s, "2024-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Planned() || p.ToBeAssigned != 2500 {
+		t.Errorf("MonthPlan without assignments = %+v, want unplanned with 2500 to assign", p)
+	}
+
+	for _, a := range []Assignment{
+		{Month: "2024-01", Category: "food", Amount: 400},
+		{Month: "2024-01", Category: "rent", Amount: 1500},
+		{Month: "2024-01", Category: "food", Amount: 300},
+		{Month: "2024-02", Category: "food", Amount: 100},
+		{Month: "2024-01", Category: "rent", Amount: 0},
+		{Month: "2024-01", Category: "rent", Amount: 2200},
+	} {
+		if err := s.Assign(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Assign(ctx, Assignment{Month: "2024-1", Category: "food", Amount: 1}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Assign with invalid month error = %v, want ErrValidation", err)
+	}
+
+	p, err = MonthPlan(ctx, s, "2024-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Planned() || len(p.Assignments) != 2 || p.Income != 2500 || p.Assigned != 2500 || p.ToBeAssigned != 0 || p.Spent["food"] != 52.5 {
+		t.Errorf("MonthPlan(2024-01) = %+v, want 300 + 2200 assigned of 2500 and 52.5 spent on food", p)
+	}
+	p, err = MonthPlan(ctx, s, "2024-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ToBeAssigned != 200 {
+		t.Errorf("MonthPlan(2024-02).ToBeAssigned = %v, want 200", p.ToBeAssigned)
+	}
+}
+
+type recordingNotifier struct {
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, a Alert) error {
+	n.alerts = append(n.alerts, a)
+	return nil
+}
+
+func testAlerts(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+	if err := s.AddBudget(ctx, Budget{Category: "food", Amount: 60, Period: "monthly", Thresholds: []float64{100, 20, 50}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddBudget(ctx, Budget{Category: "shopping", Amount: 200, Period: "monthly"}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := &recordingNotifier{}
+	check := func(category, date string) []Alert {
+		t.Helper()
+		d, _ := time.Parse(dateLayout, date)
+		sent, err := CheckAlerts(ctx, s, category, d, []Notifier{n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sent
+	}
+
+	// 52.5 of 60 passes 20% and 50% at once; only 50% is sent.
+	if sent := check("food", "2024-01-10"); len(sent) != 1 || sent[0].Threshold != 50 || sent[0].Spent != 52.5 || sent[0].Window != (DateRange{"2024-01-01", "2024-01-31"}) {
+		t.Errorf("first check sent %+v, want the 50%% alert for January", sent)
+	}
+	if sent := check("food", "2024-01-20"); len(sent) != 0 {
+		t.Errorf("second check sent %+v, want nothing", sent)
+	}
+	if _, err := s.AddTransaction(ctx, Transaction{Type: "expense", Category: "food", Amount: 10, Date: "2024-01-21"}); err != nil {
+		t.Fatal(err)
+	}
+	if sent := check("food", "2024-01-21"); len(sent) != 1 || sent[0].Threshold != 100 {
+		t.Errorf("check over the limit sent %+v, want the 100%% alert", sent)
+	}
+	if sent := check("shopping", "2024-02-02"); len(sent) != 0 {
+		t.Errorf("shopping at 75%% sent %+v, want nothing below the default thresholds", sent)
+	}
+	if sent := check("rent", "2024-02-02"); len(sent) != 0 {
+		t.Errorf("category without budget sent %+v", sent)
+	}
+	if len(n.alerts) != 2 {
+		t.Errorf("notifier got %d alerts, want 2", len(n.alerts))
+	}
+
+	alerts, err := s.GetAlerts(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 3 || alerts[0].Threshold != 100 || alerts[0].SentAt == "" {
+		t.Errorf("GetAlerts = %+v, want 3 recorded thresholds, newest first", alerts)
+	}
+	if alerts, _ = s.GetAlerts(ctx, 1); len(alerts) != 1 {
+		t.Errorf("GetAlerts with limit 1 returned %d alerts", len(alerts))
+	}
+
+	if _, err := s.AddNotifier(ctx, NotifierConfig{Kind: NotifierWebhook, Target: "not a url"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("AddNotifier with invalid URL error = %v, want ErrValidation", err)
+	}
+	id, err := s.AddNotifier(ctx, NotifierConfig{Kind: NotifierSMTP, Target: "me@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configs, _ := s.GetNotifiers(ctx); len(configs) != 1 || configs[0].ID != id {
+		t.Errorf("GetNotifiers = %+v, want the smtp notifier", configs)
+	}
+	if err = s.RemoveNotifier(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RemoveNotifier(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RemoveNotifier twice error = %v, want ErrNotFound", err)
+	}
+}
+
+func testTrends(t *testing.T, s Store) {
+	ctx := t.Context()
+	addSamples(t, s)
+	now := time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC)
+
+	trends, err := Trends(ctx, s, "month", 2, now, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trends) != 2 || trends[0].Bucket.Label != "2024-01" || trends[1].Bucket.Label != "2024-02" {
+		t.Fatalf("Trends = %+v, want January and February", trends)
+	}
+	feb := trends[1]
+	if feb.Bucket.Range != (DateRange{"2024-02-01", "2024-02-29"}) || feb.Bucket.Income != 300 || feb.Bucket.Expense != 150 || feb.Bucket.Net() != 150 {
+		t.Errorf("February bucket = %+v", feb.Bucket)
+	}
+	if feb.Previous.Label != "2024-01" || feb.Previous.Income != 2500 || feb.LastYear.Label != "2023-02" || feb.LastYear.Expense != 0 {
+		t.Errorf("February compared against %+v and %+v", feb.Previous, feb.LastYear)
+	}
+	if trends[0].Previous.Label != "2023-12" {
+		t.Errorf("January previous = %q, want 2023-12", trends[0].Previous.Label)
+	}
+
+	var order []string
+	for _, c := range CategoryChanges(feb.Previous, feb.Bucket) {
+		order = append(order, c.Category)
+	}
+	if !reflect.DeepEqual(order, []string{"shopping", "transport", "food"}) {
+		t.Errorf("CategoryChanges order = %v, want shopping, transport, food", order)
+	}
+	if c := NewChange(200, 150); c.Abs != -50 || c.Percent != -25 {
+		t.Errorf("NewChange(200, 150) = %+v", c)
+	}
+	if c := NewChange(0, 10); !math.IsNaN(c.Percent) {
+		t.Errorf("NewChange from zero percent = %v, want NaN", c.Percent)
+	}
+
+	trends, err = Trends(ctx, s, "quarter", 3, now, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trends) != 1 || trends[0].Bucket.Label != "2024-Q1" || trends[0].Previous.Label != "2023-Q4" || trends[0].Bucket.Expense != 204.75 {
+		t.Errorf("quarter Trends = %+v", trends)
+	}
+	if _, err = Trends(ctx, s, "week", 3, now, Filter{}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Trends by week error = %v, want ErrValidation", err)
+	}
+}
+
+func testCalendar(t *testing.T, s Store) {
+	ctx := t.Context()
+	ids := addSamples(t, s)
+	if err := s.DeleteTransaction(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	days, err := DailySpending(ctx, s, YearRange(2024), Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"2024-01-10": 42.25, "2024-02-02": 150}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("DailySpending = %v, want %v", days, want)
+	}
+	if got := DayThreshold(days); got != 192.25 {
+		t.Errorf("DayThreshold = %v, want 192.25", got)
+	}
+
+	r, _ := MonthRange("2024-01")
+	where, err := ParseFilter("category = food")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days, err = DailySpending(ctx, s, r, where); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(days, map[string]float64{"2024-01-10": 40}) {
+		t.Errorf("filtered DailySpending = %v", days)
+	}
+	if YearRange(2024) != (DateRange{"2024-01-01", "2024-12-31"}) {
+		t.Errorf("YearRange(2024) = %v", YearRange(2024))
+	}
+}
+
+func testForecast(t *testing.T, s Store) {
+	ctx := t.Context()
+	for _, tr := range []Transaction{
+		{Type: "income", Category: "salary", Amount: 2000, Date: "2024-01-01"},
+		{Type: "income", Category: "salary", Amount: 2000, Date: "2024-02-01"},
+		{Type: "income", Category: "salary", Amount: 2000, Date: "2024-03-01"},
+		{Type: "expense", Category: "rent", Amount: 800, Description: "Flat", Date: "2024-01-03"},
+		{Type: "expense", Category: "rent", Amount: 800, Description: "flat", Date: "2024-02-02"},
+		{Type: "expense", Category: "rent", Amount: 800, Description: "flat", Date: "2024-03-03"},
+		{Type: "expense", Category: "gym", Amount: 15, Date: "2024-01-05"},
+		{Type: "expense", Category: "gym", Amount: 15, Date: "2024-01-12"},
+		{Type: "expense", Category: "gym", Amount: 15, Date: "2024-01-19"},
+		{Type: "expense", Category: "food", Amount: 20, Date: "2024-03-05"},
+		{Type: "expense", Category: "food", Amount: 10, Date: "2024-03-08"},
+		{Type: "expense", Category: "car", Amount: 500, Date: "2024-03-20"},
+		{Type: "expense", Category: "rent", Amount: 800, Description: "flat", Date: "2024-04-02"},
+	} {
+		if _, err := s.AddTransaction(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	f, err := ForecastBalance(ctx, s, now, 1000, 30, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []string
+	for _, r := range f.Recurring {
+		series = append(series, r.Category+" "+r.Interval+" "+r.Next)
+	}
+	// The gym series stopped in January and food is irregular.
+	if want := []string{"salary monthly 2024-04-01", "rent monthly 2024-04-03"}; !reflect.DeepEqual(series, want) {
+		t.Errorf("Recurring = %v, want %v", series, want)
+	}
+	if f.NextPayday != "2024-04-01" {
+		t.Errorf("NextPayday = %q, want 2024-04-01", f.NextPayday)
+	}
+	if !reflect.DeepEqual(f.Discretionary, map[string]float64{"food": 3}) {
+		t.Errorf("Discretionary = %v, want food 3/day", f.Discretionary)
+	}
+
+	// Rent entered for April 2nd replaces the projected April 3rd.
+	if len(f.Days) != 30 || f.Days[29].Date != "2024-04-09" || math.Abs(f.Days[29].Balance-1610) > 1e-9 {
+		t.Errorf("last day = %+v, want 1610 on 2024-04-09", f.Days[len(f.Days)-1])
+	}
+	if f.Lowest.Date != "2024-03-31" || math.Abs(f.Lowest.Balance-437) > 1e-9 {
+		t.Errorf("Lowest = %+v, want 437 on 2024-03-31", f.Lowest)
+	}
+	first := f.Days[0]
+	if spread := first.High - first.Balance; math.Abs(spread-1.645*math.Sqrt(41)) > 1e-9 || math.Abs(first.Balance-first.Low-spread) > 1e-9 {
+		t.Errorf("first day band = %+v", first)
+	}
+	if last := f.Days[29]; last.High-last.Low <= first.High-first.Low {
+		t.Error("band does not widen over time")
+	}
+
+	if _, err = ForecastBalance(ctx, s, now, 0, 0, 10); !errors.Is(err, ErrValidation) {
+		t.Errorf("ForecastBalance with no days error = %v, want ErrValidation", err)
+	}
+}
+
+func testAnomalies(t *testing.T, s Store) {
+	ctx := t.Context()
+	expense := func(category string, amount float64, desc, date string) {
+		t.Helper()
+		if _, err := s.AddTransaction(ctx, Transaction{Type: "expense", Category: category, Amount: amount, Description: desc, Date: date}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, amount := range []float64{20, 22, 25, 28, 30, 32, 35, 38, 40, 24} {
+		expense("food", amount, "", fmt.Sprintf("2024-01-%02d", i+2))
+	}
+	for _, date := range []string{"2023-12-05", "2024-01-05", "2024-02-05"} {
+		expense("subscriptions", 5, "MusicBox", date)
+	}
+	for _, date := range []string{"2024-02-01", "2024-02-02", "2024-02-03", "2024-02-04", "2024-03-05", "2024-03-06"} {
+		expense("coffee", 3, "espresso", date)
+	}
+	expense("subscriptions", 10, "musicbox", "2024-03-05")
+	expense("food", 300, "", "2024-03-10")
+	for _, date := range []string{"2024-01-14", "2024-02-14", "2024-03-14"} {
+		expense("subscriptions", 9.99, "Streamly", date)
+	}
+	expense("coffee", 4.5, "coffee shop", "2024-03-20")
+	expense("coffee", 4.5, "Coffee shop.", "2024-03-21")
+
+	anomalies, err := FindAnomalies(ctx, s, AnomalyOptions{Window: DateRange{"2024-03-01", "2024-03-31"}, History: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range anomalies {
+		got = append(got, a.Transaction.Date+" "+a.Kind)
+	}
+	want := []string{
+		"2024-03-05 outlier",
+		"2024-03-10 outlier",
+		"2024-03-14 new recurring",
+		"2024-03-21 duplicate",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FindAnomalies = %v, want %v", got, want)
+	}
+	if reason := anomalies[0].Reason; reason != `$10.00 is 2.0x the usual $5.00 for "musicbox" (median of 3 earlier expenses)` {
+		t.Errorf("payee outlier reason = %q", reason)
+	}
+	if reason := anomalies[1].Reason; reason != "$300.00 is 10.3x the usual $29.00 for category food (median of 10 earlier expenses)" {
+		t.Errorf("category outlier reason = %q", reason)
+	}
+
+	// dedupe finds the duplicates anomalies flags; it also groups the
+	// espressos, which anomalies leaves alone as a daily habit.
+	groups, err := FindDuplicates(ctx, s, DateRange{"2024-03-01", "2024-03-31"}, DuplicateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range anomalies {
+		if a.Kind != AnomalyDuplicate {
+			continue
+		}
+		found := false
+		for _, g := range groups {
+			found = found || slices.ContainsFunc(g, func(tr Transaction) bool { return tr.ID == a.Transaction.ID })
+		}
+		if !found {
+			t.Errorf("duplicate anomaly %+v is not in FindDuplicates %+v", a.Transaction, groups)
+		}
+	}
+
+	// Less sensitive, the doubled subscription is no longer an outlier but
+	// the huge meal still is.
+	if anomalies, err = FindAnomalies(ctx, s, AnomalyOptions{Window: DateRange{"2024-03-01", "2024-03-31"}, History: 90, Sensitivity: 15}); err != nil {
+		t.Fatal(err)
+	}
+	if len(anomalies) != 3 || anomalies[0].Transaction.Date != "2024-03-10" {
+		t.Errorf("FindAnomalies with sensitivity 15 = %+v", anomalies)
+	}
+	if _, err = FindAnomalies(ctx, s, AnomalyOptions{Window: DateRange{"2024-03-01", "2024-03-31"}}); !errors.Is(err, ErrValidation) {
+		t.Errorf("FindAnomalies without history error = %v, want ErrValidation", err)
+	}
+}
+
+func testDuplicates(t *testing.T, s Store) {
+	ctx := t.Context()
+	var ids []int
+	for _, tr := range []Transaction{
+		{Type: "expense", Category: "food", Amount: 12.5, Date: "2024-01-03"},
+		{Type: "expense", Category: "Food", Amount: 12.5, Description: "Coffee beans", Date: "2024-01-01"},
+		{Type: "expense", Category: "food", Amount: 12.5, Description: "coffee  beans", Date: "2024-01-03"},
+		{Type: "expense", Category: "food", Amount: 12.5, Description: "coffee bean", Date: "2024-01-04"},
+		{Type: "expense", Category: "food", Amount: 12.5, Description: "coffee beans", Date: "2024-01-09"},
+		{Type: "expense", Category: "food", Amount: 12.6, Description: "groceries", Date: "2024-01-10"},
+		{Type: "expense", Category: "food", Amount: 12.5, Description: "groceries", Date: "2024-01-11"},
+		{Type: "income", Category: "food", Amount: 12.5, Description: "groceries", Date: "2024-01-11"},
+	} {
+		id, err := s.AddTransaction(ctx, tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	groupIDs := func(groups [][]Transaction) [][]int {
+		out := [][]int{}
+		for _, g := range groups {
+			out = append(out, transactionIDs(g))
+		}
+		return out
+	}
+	groups, err := FindDuplicates(ctx, s, DateRange{}, DuplicateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{ids[1], ids[2], ids[3]}}; !reflect.DeepEqual(groupIDs(groups), want) {
+		t.Errorf("FindDuplicates = %v, want %v", groupIDs(groups), want)
+	}
+	groups, err = FindDuplicates(ctx, s, DateRange{Start: "2024-01-02"}, DuplicateOptions{AmountTolerance: 0.01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{ids[2], ids[3]}, {ids[5], ids[6]}}; !reflect.DeepEqual(groupIDs(groups), want) {
+		t.Errorf("FindDuplicates with tolerance = %v, want %v", groupIDs(groups), want)
+	}
+	if _, err = FindDuplicates(ctx, s, DateRange{}, DuplicateOptions{Similarity: 2}); !errors.Is(err, ErrValidation) {
+		t.Errorf("FindDuplicates with similarity 2 error = %v, want ErrValidation", err)
+	}
+
+	possible, err := PossibleDuplicates(ctx, s, Transaction{Type: "expense", Category: "food", Amount: 12.5, Description: "COFFEE BEANS", Date: "2024-01-06"}, DuplicateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := transactionIDs(possible); !reflect.DeepEqual(got, []int{ids[2], ids[3], ids[4]}) {
+		t.Errorf("PossibleDuplicates = %v, want %v", got, []int{ids[2], ids[3], ids[4]})
+	}
+
+	// The kept transaction has no description and takes one from the
+	// first duplicate that has.
+	if err = s.MergeTransactions(ctx, ids[0], []int{ids[2], ids[1], ids[2]}); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.GetTransaction(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept.Description != "Coffee beans" || kept.Version != 2 {
+		t.Errorf("kept = %+v, want description Coffee beans at version 2", kept)
+	}
+	for _, id := range ids[1:3] {
+		if tr, err := s.GetTransaction(ctx, id); err != nil || tr.DeletedAt == "" {
+			t.Errorf("merged #%d = %+v, %v, want it in the trash", id, tr, err)
+		}
+	}
+
+	if err = s.MergeTransactions(ctx, ids[3], []int{ids[1]}); !errors.Is(err, ErrConflict) {
+		t.Errorf("merging a trashed transaction error = %v, want ErrConflict", err)
+	}
+	if err = s.MergeTransactions(ctx, ids[3], []int{999}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("merging a missing transaction error = %v, want ErrNotFound", err)
+	}
+	if err = s.MergeTransactions(ctx, ids[3], []int{ids[3]}); !errors.Is(err, ErrValidation) {
+		t.Errorf("merging into itself error = %v, want ErrValidation", err)
+	}
+	if tr, _ := s.GetTransaction(ctx, ids[3]); tr.Version != 1 {
+		t.Errorf("failed merges changed #%d to version %d", ids[3], tr.Version)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"Coffee  Beans", "coffee beans", 1},
+		{"abcd", "abce", 0.75},
+		{"rent", "", 0},
+	}
+	for _, tt := range tests {
+		if got := Similarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func testRules(t *testing.T, s Store) {
+	ctx := t.Context()
+	for _, r := range []Rule{
+		{Category: "food"},
+		{Pattern: "x", Type: "gift", Category: "food"},
+		{Pattern: "(", Category: "food"},
+		{MinAmount: 10, MaxAmount: 5, Category: "food"},
+		{Pattern: "x"},
+		{Pattern: "x", Tags: " , "},
+	} {
+		if _, err := s.AddRule(ctx, r); !errors.Is(err, ErrValidation) {
+			t.Errorf("AddRule(%+v) error = %v, want ErrValidation", r, err)
+		}
+	}
+
+	rules := []Rule{
+		{Pattern: `(?i)^amzn mktp (?P<country>\w+)`, Category: "shopping", Tags: "online", Rewrite: "Amazon ${country}"},
+		{Payee: "Starbucks", MaxAmount: 10, Tags: "coffee-shop"},
+		{Type: "income", MinAmount: 1000, Category: "salary"},
+		{Pattern: "(?i)amzn", Category: "other"},
+	}
+	for i, r := range rules {
+		id, err := s.AddRule(ctx, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules[i].ID = id
+	}
+	stored, err := s.GetRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, rules) {
+		t.Fatalf("GetRules = %+v, want %+v", stored, rules)
+	}
+
+	tests := []struct {
+		in       Transaction
+		rule     int
+		category string
+		tags     string
+		desc     string
+	}{
+		{Transaction{Type: "expense", Amount: 30, Description: "AMZN Mktp US*2K4"}, rules[0].ID, "shopping", "online", "Amazon US"},
+		{Transaction{Type: "expense", Amount: 30, Description: "AMZN Mktp UK", Tags: "work,online"}, rules[0].ID, "shopping", "work,online", "Amazon UK"},
+		{Transaction{Type: "expense", Amount: 30, Description: "amzn prime"}, rules[3].ID, "other", "", "amzn prime"},
+		{Transaction{Type: "expense", Amount: 4, Description: " starbucks", Category: "food"}, rules[1].ID, "food", "coffee-shop", " starbucks"},
+		{Transaction{Type: "expense", Amount: 12, Description: "starbucks", Category: "misc"}, 0, "misc", "", "starbucks"},
+		{Transaction{Type: "income", Amount: 2500}, rules[2].ID, "salary", "", ""},
+		{Transaction{Type: "expense", Amount: 2500}, 0, "", "", ""},
+	}
+	for _, tt := range tests {
+		got, id := ApplyRules(stored, tt.in)
+		if id != tt.rule || got.Category != tt.category || got.Tags != tt.tags || got.Description != tt.desc {
+			t.Errorf("ApplyRules(%+v) = %+v by #%d, want %q, %q, %q by #%d", tt.in, got, id, tt.category, tt.tags, tt.desc, tt.rule)
+		}
+	}
+
+	ids := addSamples(t, s)
+	amazon, err := s.AddTransaction(ctx, Transaction{Type: "expense", Category: "misc", Amount: 30, Description: "AMZN Mktp DE", Tags: "work, work", Date: "2024-01-05"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := PreviewRules(ctx, s, TransactionFilter{SortBy: "id", Ascending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The samples already have the categories the rules would give them.
+	if len(changes) != 1 || changes[0].Before.ID != amazon || changes[0].RuleID != rules[0].ID || changes[0].After.Description != "Amazon DE" {
+		t.Fatalf("PreviewRules = %+v", changes)
+	}
+
+	if err = s.UpdateTransaction(ctx, amazon, Transaction{Amount: -1, Description: "AMZN Mktp FR"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ApplyRuleChanges(ctx, s, changes); !errors.Is(err, ErrConflict) {
+		t.Errorf("ApplyRuleChanges after a concurrent change error = %v, want ErrConflict", err)
+	}
+	if tr, _ := s.GetTransaction(ctx, amazon); tr.Category != "misc" || tr.Description != "AMZN Mktp FR" {
+		t.Errorf("failed ApplyRuleChanges changed #%d to %+v", amazon, tr)
+	}
+
+	if changes, err = PreviewRules(ctx, s, TransactionFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	n, err := ApplyRuleChanges(ctx, s, changes)
+	if err != nil || n != 1 {
+		t.Fatalf("ApplyRuleChanges = %d, %v, want 1", n, err)
+	}
+	tr, err := s.GetTransaction(ctx, amazon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Category != "shopping" || tr.Tags != "work,online" || tr.Description != "Amazon FR" || tr.Version != 3 {
+		t.Errorf("after ApplyRuleChanges #%d = %+v", amazon, tr)
+	}
+	if changes, _ = PreviewRules(ctx, s, TransactionFilter{}); len(changes) != 0 {
+		t.Errorf("PreviewRules after applying = %+v, want nothing", changes)
+	}
+
+	// A transaction that went to the trash or was deleted after the
+	// preview fails the whole change.
+	if err = s.DeleteTransaction(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	for _, patches := range []map[int]Transaction{
+		{ids[1]: {Amount: -1, Category: "coffee"}, ids[2]: {Amount: -1, Category: "groceries"}},
+		{999: {Amount: -1, Category: "coffee"}, ids[2]: {Amount: -1, Category: "groceries"}},
+	} {
+		if n, err = s.PatchTransactions(ctx, patches); !errors.Is(err, ErrConflict) || n != 0 {
+			t.Errorf("PatchTransactions(%v) = %d, %v, want ErrConflict", patches, n, err)
+		}
+	}
+	if tr, _ = s.GetTransaction(ctx, ids[2]); tr.Category != "food" {
+		t.Errorf("failed PatchTransactions changed #%d to %+v", ids[2], tr)
+	}
+
+	if err = s.RemoveRule(ctx, rules[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RemoveRule(ctx, rules[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RemoveRule twice error = %v, want ErrNotFound", err)
+	}
+	if stored, _ = s.GetRules(ctx); len(stored) != 3 || stored[0].ID != rules[1].ID {
+		t.Errorf("GetRules after remove = %+v", stored)
+	}
+}
@@ -0,0 +1,290 @@
+// Package tracker is a personal finance library: transactions, budgets and
+// the statistics over them, stored in SQLite with an undo journal, an audit
+// log, backups and optional encryption. The finance command in cmd/finance
+// is a thin CLI on top of it.
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Transaction struct {
+	ID          int
+	Type        string
+	Category    string
+	Amount      float64
+	Description string
+	// Tags is a comma-separated list such as "travel,work", kept in the
+	// form JoinTags gives it.
+	Tags      string
+	Date      string
+	DeletedAt string
+	// Version starts at 1 and grows with every change to the row. An
+	// update that carries a non-zero Version only applies while the
+	// stored row is still at that version.
+	Version int
+}
+
+type Budget struct {
+	ID       int
+	Category string
+	Amount   float64
+	// Period is weekly, biweekly, monthly, quarterly, yearly or "<N>d".
+	Period string
+	// Anchor is a date on which a period starts; periods repeat from it in
+	// both directions. Without one they follow the calendar.
+	Anchor string
+	// StartDate and EndDate limit when the budget applies at all.
+	StartDate string
+	EndDate   string
+	// Rollover says what is left of a period carries into the next one:
+	// RolloverNone (or empty), RolloverSurplus, RolloverBoth or
+	// RolloverCapped, which carries surplus up to RolloverCap.
+	Rollover    string
+	RolloverCap float64
+	// Thresholds are the percentages of the limit at which alerts fire,
+	// DefaultThresholds when empty.
+	Thresholds []float64
+	Version    int
+}
+
+// BudgetAmount is one entry in the history of a budget's limit: Amount
+// applies from EffectiveFrom until the next entry. The first entry has an
+// empty EffectiveFrom and applies since the budget began.
+type BudgetAmount struct {
+	ID            int
+	Category      string
+	Amount        float64
+	EffectiveFrom string
+}
+
+type TransactionFilter struct {
+	Type      string
+	Category  string
+	StartDate string
+	EndDate   string
+	MinAmount float64
+	MaxAmount float64
+	Where     Filter
+	SortBy    string
+	Ascending bool
+	Limit     int
+	Offset    int
+	Trashed   bool
+}
+
+type TransactionTotals struct {
+	Count   int
+	Income  float64
+	Expense float64
+}
+
+var (
+	// ErrNotFound is matched by errors about rows that do not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrValidation is matched by errors about invalid input.
+	ErrValidation = errors.New("invalid input")
+	// ErrConflict is matched by errors about rows whose current state does
+	// not allow the operation, such as updating a trashed transaction.
+	ErrConflict = errors.New("conflict")
+)
+
+// kindError carries a readable message while still matching one of the
+// sentinel errors above with errors.Is.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func notFoundf(format string, args ...interface{}) error {
+	return &kindError{ErrNotFound, fmt.Sprintf(format, args...)}
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return &kindError{ErrValidation, fmt.Sprintf(format, args...)}
+}
+
+func conflictf(format string, args ...interface{}) error {
+	return &kindError{ErrConflict, fmt.Sprintf(format, args...)}
+}
+
+// staleVersion reports an update made against an outdated copy of a row.
+func staleVersion(id, expected, current int) error {
+	return conflictf("transaction #%d was changed by someone else (expected version %d, now %d), reload it and try again", id, expected, current)
+}
+
+// bulkTarget reports whether a bulk operation changes the transaction
+// with id, which is current if found. One expected at version 0 is
+// skipped when it is missing or in the trash; any other version must
+// still be live and match, or the whole operation fails.
+func bulkTarget(id, expected int, current Transaction, found bool) (bool, error) {
+	live := found && current.DeletedAt == ""
+	switch {
+	case expected == 0:
+		return live, nil
+	case !found:
+		return false, conflictf("transaction #%d no longer exists", id)
+	case !live:
+		return false, conflictf("transaction #%d is in the trash", id)
+	case current.Version != expected:
+		return false, staleVersion(id, expected, current.Version)
+	}
+	return true, nil
+}
+
+func ValidateTransaction(t Transaction) error {
+	if t.Type != "income" && t.Type != "expense" {
+		return invalidf("type must be 'income' or 'expense'")
+	}
+	if t.Amount <= 0 {
+		return invalidf("amount must be positive")
+	}
+	if t.Category == "" {
+		return invalidf("category is required")
+	}
+	if _, err := time.Parse(dateLayout, t.Date); err != nil {
+		return invalidf("invalid date format, use YYYY-MM-DD")
+	}
+	return nil
+}
+
+// mergeTransaction applies the fields set in update to t: non-empty strings
+// and an Amount other than -1. update has passed ValidatePatch.
+func mergeTransaction(t, update Transaction) Transaction {
+	if update.Type != "" {
+		t.Type = update.Type
+	}
+	if update.Category != "" {
+		t.Category = update.Category
+	}
+	if update.Amount > 0 {
+		t.Amount = update.Amount
+	}
+	if update.Description != "" {
+		t.Description = update.Description
+	}
+	if update.Tags != "" {
+		t.Tags = JoinTags(update.Tags)
+	}
+	if update.Date != "" {
+		t.Date = update.Date
+	}
+	return t
+}
+
+// JoinTags combines comma-separated lists of tags into one, trimming
+// spaces and dropping blanks and repeats, in order of first appearance.
+func JoinTags(lists ...string) string {
+	var tags []string
+	for _, list := range lists {
+		for _, tag := range strings.Split(list, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return strings.Join(tags, ",")
+}
+
+// ValidatePatch checks the fields an update would set, before there is a
+// row to merge them with. An Amount of 0 or -1 leaves the amount
+// unchanged; any other amount must be positive.
+func ValidatePatch(update Transaction) error {
+	if update.Type != "" && update.Type != "income" && update.Type != "expense" {
+		return invalidf("type must be 'income' or 'expense'")
+	}
+	if update.Amount != -1 && update.Amount < 0 {
+		return invalidf("amount must be positive")
+	}
+	if update.Date != "" {
+		if _, err := time.Parse(dateLayout, update.Date); err != nil {
+			return invalidf("invalid date format, use YYYY-MM-DD")
+		}
+	}
+	return nil
+}
+
+func validateBudgetAmount(amount float64, effective string) error {
+	if amount <= 0 {
+		return invalidf("amount must be positive")
+	}
+	if _, err := time.Parse(dateLayout, effective); err != nil {
+		return invalidf("invalid effective date format, use YYYY-MM-DD")
+	}
+	return nil
+}
+
+func ValidateBudget(b Budget) error {
+	if b.Category == "" {
+		return invalidf("category is required")
+	}
+
+	if b.Amount <= 0 {
+		return invalidf("amount must be positive")
+	}
+
+	if _, err := parseBudgetPeriod(b.Period); err != nil {
+		return err
+	}
+
+	if b.Anchor != "" {
+		if _, err := time.Parse(dateLayout, b.Anchor); err != nil {
+			return invalidf("invalid anchor date format, use YYYY-MM-DD")
+		}
+	}
+
+	if b.StartDate != "" {
+		if _, err := time.Parse(dateLayout, b.StartDate); err != nil {
+			return invalidf("invalid start date format, use YYYY-MM-DD")
+		}
+	}
+
+	if b.EndDate != "" {
+		if _, err := time.Parse(dateLayout, b.EndDate); err != nil {
+			return invalidf("invalid end date format, use YYYY-MM-DD")
+		}
+	}
+
+	if b.EndDate != "" && b.StartDate == "" {
+		return invalidf("start date is required when end date is specified")
+	}
+
+	if b.StartDate != "" && b.EndDate != "" && b.EndDate < b.StartDate {
+		return invalidf("end date cannot be before start date")
+	}
+
+	switch b.Rollover {
+	case "", RolloverNone, RolloverSurplus, RolloverBoth:
+		if b.RolloverCap != 0 {
+			return invalidf("a rollover cap only applies to capped rollover")
+		}
+	case RolloverCapped:
+		if b.RolloverCap <= 0 {
+			return invalidf("capped rollover needs a positive cap")
+		}
+	default:
+		return invalidf("invalid rollover %q, must be none, surplus, both or capped", b.Rollover)
+	}
+	if b.Rollover != "" && b.Rollover != RolloverNone && b.StartDate == "" {
+		return invalidf("rollover needs a start date to carry from")
+	}
+	for _, t := range b.Thresholds {
+		if t <= 0 {
+			return invalidf("alert thresholds must be positive percentages")
+		}
+	}
+
+	return nil
+}
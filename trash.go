@@ -0,0 +1,59 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (s *SQLiteStore) RestoreTransaction(ctx context.Context, id int) error {
+	return s.withJournal(ctx, func(j *journal) error {
+		before, err := getTransaction(ctx, j.tx, id)
+		if err != nil {
+			return err
+		}
+		if before.DeletedAt == "" {
+			return conflictf("transaction #%d is not in the trash", id)
+		}
+		res, err := j.tx.ExecContext(ctx, "UPDATE transactions SET deleted_at = NULL, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL", id)
+		if err != nil {
+			return err
+		}
+		if err = checkAffected(res, id); err != nil {
+			return err
+		}
+		after := before
+		after.DeletedAt = ""
+		after.Version++
+		return j.transaction(id, &before, &after)
+	})
+}
+
+// EmptyTrash permanently removes trashed transactions deleted at least
+// olderThan ago. A zero duration empties the whole trash.
+func (s *SQLiteStore) EmptyTrash(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if _, err := s.autoBackup(ctx, "trash-empty"); err != nil {
+		return 0, fmt.Errorf("backup before emptying trash failed: %w", err)
+	}
+
+	cutoff := time.Now().Add(-olderThan).Format("2006-01-02 15:04:05")
+	var removed int64
+	err := s.withJournal(ctx, func(j *journal) error {
+		trashed, err := scanTransactions(ctx, j.tx,
+			"SELECT "+transactionColumns+" FROM transactions WHERE deleted_at IS NOT NULL AND deleted_at <= ? ORDER BY id", cutoff)
+		if err != nil {
+			return err
+		}
+		for i := range trashed {
+			if _, err = j.tx.ExecContext(ctx, "DELETE FROM transactions WHERE id = ?", trashed[i].ID); err != nil {
+				return err
+			}
+			if err = j.transaction(trashed[i].ID, &trashed[i], nil); err != nil {
+				return err
+			}
+		}
+		removed = int64(len(trashed))
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,139 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// TrendBucket holds the totals of one month, quarter or year.
+type TrendBucket struct {
+	Label      string
+	Range      DateRange
+	Income     float64
+	Expense    float64
+	Categories map[string]float64
+}
+
+func (b TrendBucket) Net() float64 {
+	return b.Income - b.Expense
+}
+
+// Trend is a bucket next to the one before it and the same bucket a year
+// earlier.
+type Trend struct {
+	Bucket   TrendBucket
+	Previous TrendBucket
+	LastYear TrendBucket
+}
+
+// Change is the difference between two totals. Percent is NaN when the
+// earlier total is zero.
+type Change struct {
+	From    float64
+	To      float64
+	Abs     float64
+	Percent float64
+}
+
+func NewChange(from, to float64) Change {
+	c := Change{From: from, To: to, Abs: to - from, Percent: math.NaN()}
+	if from != 0 {
+		c.Percent = c.Abs / math.Abs(from) * 100
+	}
+	return c
+}
+
+// CategoryChange is how the spending of one category changed between two
+// buckets.
+type CategoryChange struct {
+	Category string
+	Change
+}
+
+var trendPeriods = map[string]string{
+	"month":   "monthly",
+	"quarter": "quarterly",
+	"year":    "yearly",
+}
+
+// Trends returns the buckets of the given size (month, quarter or year)
+// that cover the last months months up to now, oldest first, each with
+// the buckets it is compared against.
+func Trends(ctx context.Context, s Store, by string, months int, now time.Time, where Filter) ([]Trend, error) {
+	name, ok := trendPeriods[by]
+	if !ok {
+		return nil, invalidf("invalid bucket %q, must be month, quarter or year", by)
+	}
+	if months <= 0 {
+		return nil, invalidf("number of months must be positive")
+	}
+	p := budgetPeriods[name]
+	count := (months + p.months - 1) / p.months
+	perYear := 12 / p.months
+
+	// Walk back from the current bucket far enough to also cover the year
+	// before the oldest one shown.
+	ranges := make([]DateRange, count+perYear)
+	date := truncateDay(now)
+	for i := len(ranges) - 1; i >= 0; i-- {
+		ranges[i] = p.containing(date, time.Time{})
+		start, _ := time.Parse(dateLayout, ranges[i].Start)
+		date = start.AddDate(0, 0, -1)
+	}
+
+	buckets := make([]TrendBucket, len(ranges))
+	for i, r := range ranges {
+		b := TrendBucket{Label: bucketLabel(by, r), Range: r}
+		var err error
+		if b.Income, b.Expense, err = s.GetBalance(ctx, r, where); err != nil {
+			return nil, err
+		}
+		if b.Categories, err = s.GetCategoryStats(ctx, r, where); err != nil {
+			return nil, err
+		}
+		buckets[i] = b
+	}
+
+	trends := make([]Trend, count)
+	for i := range trends {
+		j := perYear + i
+		trends[i] = Trend{Bucket: buckets[j], Previous: buckets[j-1], LastYear: buckets[j-perYear]}
+	}
+	return trends, nil
+}
+
+func bucketLabel(by string, r DateRange) string {
+	start, _ := time.Parse(dateLayout, r.Start)
+	switch by {
+	case "month":
+		return start.Format("2006-01")
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", start.Year(), (int(start.Month())-1)/3+1)
+	default:
+		return start.Format("2006")
+	}
+}
+
+// CategoryChanges compares the spending per category of two buckets,
+// largest increase first.
+func CategoryChanges(from, to TrendBucket) []CategoryChange {
+	var changes []CategoryChange
+	for category, amount := range to.Categories {
+		changes = append(changes, CategoryChange{category, NewChange(from.Categories[category], amount)})
+	}
+	for category, amount := range from.Categories {
+		if _, ok := to.Categories[category]; !ok {
+			changes = append(changes, CategoryChange{category, NewChange(amount, 0)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Abs != changes[j].Abs {
+			return changes[i].Abs > changes[j].Abs
+		}
+		return changes[i].Category < changes[j].Category
+	})
+	return changes
+}